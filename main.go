@@ -21,35 +21,75 @@ import (
 )
 
 type config struct {
-	Address    string        `json:"address"`
-	Timeout    time.Duration `json:"timeout"`
-	Host       string        `json:"host"`
-	Port       int           `json:"port"`
-	Username   string        `json:"username"`
-	InitialDB  string        `json:"initialdb"`
-	Exceptions []string      `json:"exceptions"`
-	Threshold  int64         `json:"threshold"`
-	Interval   time.Duration `json:"interval"`
-	Pause      time.Duration `json:"pause"`
-	Prefix     string        `json:"prefix"`
-	Verbose    bool          `json:"verbose"`
+	Address             string           `json:"address"`
+	Timeout             time.Duration    `json:"timeout"`
+	Host                string           `json:"host"`
+	Port                int              `json:"port"`
+	Username            string           `json:"username"`
+	InitialDB           string           `json:"initialdb"`
+	Exceptions          []string         `json:"exceptions"`
+	Threshold           int64            `json:"threshold"`
+	Interval            time.Duration    `json:"interval"`
+	Pause               time.Duration    `json:"pause"`
+	Partitions          bool             `json:"partitions"`
+	Top                 int              `json:"top"`
+	TopPerSchema        bool             `json:"topPerSchema"`
+	Bloat               bool             `json:"bloat"`
+	BloatInterval       time.Duration    `json:"bloatInterval"`
+	PgstattupleTop      int              `json:"pgstattupleTop"`
+	PgstattupleFull     bool             `json:"pgstattupleFull"`
+	PgstattupleInterval time.Duration    `json:"pgstattupleInterval"`
+	PgstattupleBudget   time.Duration    `json:"pgstattupleBudget"`
+	GrowthWindow        int              `json:"growthWindow"`
+	Capacity            map[string]int64 `json:"capacity"`
+	TablespaceCapacity  map[string]int64 `json:"tablespaceCapacity"`
+	AnomalyZScore       float64          `json:"anomalyZScore"`
+	AnomalyPercent      float64          `json:"anomalyPercent"`
+	Prefix              string           `json:"prefix"`
+	Verbose             bool             `json:"verbose"`
 }
 
 func defaults() config {
 	scanDefaults := scanner.Defaults()
 	return config{
-		Address:    ":8080",
-		Timeout:    5 * time.Second,
-		Host:       "localhost",
-		Port:       5432,
-		Username:   "postgres",
-		InitialDB:  scanDefaults.InitialDB,
-		Threshold:  max(scanDefaults.Threshold, units.GB),
-		Exceptions: []string{},
-		Interval:   30 * time.Minute,
+		Address:             ":8080",
+		Timeout:             5 * time.Second,
+		Host:                "localhost",
+		Port:                5432,
+		Username:            "postgres",
+		InitialDB:           scanDefaults.InitialDB,
+		Threshold:           max(scanDefaults.Threshold, units.GB),
+		Exceptions:          []string{},
+		Interval:            30 * time.Minute,
+		BloatInterval:       scanDefaults.BloatInterval,
+		PgstattupleTop:      scanDefaults.PgstattupleTop,
+		PgstattupleInterval: scanDefaults.PgstattupleInterval,
+		PgstattupleBudget:   scanDefaults.PgstattupleBudget,
+		GrowthWindow:        scanDefaults.GrowthWindow,
+		Capacity:            map[string]int64{},
+		TablespaceCapacity:  map[string]int64{},
+		AnomalyZScore:       scanDefaults.AnomalyZScore,
+		AnomalyPercent:      scanDefaults.AnomalyPercent,
 	}
 }
 
+// capacities convierte una lista de pares `nombre=tamaño` en un mapa
+func capacities(pairs []string) (map[string]int64, error) {
+	result := make(map[string]int64, len(pairs))
+	for _, pair := range pairs {
+		name, size, found := strings.Cut(pair, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("capacity %q must have the format name=size", pair)
+		}
+		capacity, err := units.FromHumanSize(size)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = capacity
+	}
+	return result, nil
+}
+
 func (c *config) Flags() []cli.Flag {
 	return []cli.Flag{
 		&cli.StringFlag{
@@ -114,7 +154,7 @@ func (c *config) Flags() []cli.Flag {
 		&cli.StringFlag{
 			Name:    "threshold",
 			Aliases: []string{"T"},
-			Usage:   "drop metrics for tables below this size",
+			Usage:   "drop metrics for tables and indexes below this size",
 			Value:   units.HumanSize(float64(c.Threshold)),
 			Action: func(_ *cli.Context, threshold string) error {
 				th, err := units.FromHumanSize(threshold)
@@ -126,6 +166,27 @@ func (c *config) Flags() []cli.Flag {
 			},
 			Required: false,
 		},
+		&cli.BoolFlag{
+			Name:        "partitions",
+			Usage:       "export the size of each partition, besides the partitioned table",
+			Value:       c.Partitions,
+			Destination: &c.Partitions,
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "top",
+			Usage:       "keep metrics for the N largest tables of each database, even if below threshold",
+			Value:       c.Top,
+			Destination: &c.Top,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "top-per-schema",
+			Usage:       "apply --top to each schema instead of each database",
+			Value:       c.TopPerSchema,
+			Destination: &c.TopPerSchema,
+			Required:    false,
+		},
 		&cli.DurationFlag{
 			Name:        "interval",
 			Aliases:     []string{"i"},
@@ -134,6 +195,95 @@ func (c *config) Flags() []cli.Flag {
 			Usage:       "polling interval",
 			Required:    false,
 		},
+		&cli.BoolFlag{
+			Name:        "bloat",
+			Usage:       "estimate table and index bloat",
+			Value:       c.Bloat,
+			Destination: &c.Bloat,
+			Required:    false,
+		},
+		&cli.DurationFlag{
+			Name:        "bloat-interval",
+			Value:       c.BloatInterval,
+			Destination: &c.BloatInterval,
+			Usage:       "bloat estimation interval",
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "pgstattuple-top",
+			Usage:       "measure the N largest tables of each database with pgstattuple, if installed",
+			Value:       c.PgstattupleTop,
+			Destination: &c.PgstattupleTop,
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "pgstattuple-full",
+			Usage:       "use pgstattuple instead of pgstattuple_approx",
+			Value:       c.PgstattupleFull,
+			Destination: &c.PgstattupleFull,
+			Required:    false,
+		},
+		&cli.DurationFlag{
+			Name:        "pgstattuple-interval",
+			Value:       c.PgstattupleInterval,
+			Destination: &c.PgstattupleInterval,
+			Usage:       "pgstattuple measurement interval",
+			Required:    false,
+		},
+		&cli.DurationFlag{
+			Name:        "pgstattuple-budget",
+			Value:       c.PgstattupleBudget,
+			Destination: &c.PgstattupleBudget,
+			Usage:       "total time budget for pgstattuple measurements in each run, shared by all databases",
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "growth-window",
+			Usage:       "number of scans used to estimate growth rates",
+			Value:       c.GrowthWindow,
+			Destination: &c.GrowthWindow,
+			Required:    false,
+		},
+		&cli.StringSliceFlag{
+			Name:  "capacity",
+			Usage: "capacity of a database, as name=size, to forecast when it will be full",
+			Action: func(_ *cli.Context, pairs []string) error {
+				capacity, err := capacities(pairs)
+				if err != nil {
+					return err
+				}
+				c.Capacity = capacity
+				return nil
+			},
+			Required: false,
+		},
+		&cli.StringSliceFlag{
+			Name:  "tablespace-capacity",
+			Usage: "capacity of a tablespace, as name=size, to forecast when it will be full",
+			Action: func(_ *cli.Context, pairs []string) error {
+				capacity, err := capacities(pairs)
+				if err != nil {
+					return err
+				}
+				c.TablespaceCapacity = capacity
+				return nil
+			},
+			Required: false,
+		},
+		&cli.Float64Flag{
+			Name:        "anomaly-zscore",
+			Usage:       "flag table growth with a z-score above this value as anomalous, requires --growth-window of at least 5 (0 to disable)",
+			Value:       c.AnomalyZScore,
+			Destination: &c.AnomalyZScore,
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "anomaly-percent",
+			Usage:       "flag table growth above this percentage between scans as anomalous (0 to disable)",
+			Value:       c.AnomalyPercent,
+			Destination: &c.AnomalyPercent,
+			Required:    false,
+		},
 		&cli.StringFlag{
 			Name:        "prefix",
 			Aliases:     []string{"P"},
@@ -163,6 +313,27 @@ func (c *config) Validate() error {
 	if c.Interval < 5*time.Minute {
 		return errors.New("period must be greater than 5 minutes")
 	}
+	if c.Bloat && c.BloatInterval < c.Interval {
+		return errors.New("bloat interval must be greater than polling interval")
+	}
+	if c.Top < 0 {
+		return errors.New("top must not be negative")
+	}
+	if c.GrowthWindow < 2 {
+		return errors.New("growth window must be at least 2 scans")
+	}
+	if c.AnomalyZScore > 0 && c.GrowthWindow < 5 {
+		return errors.New("growth window must be at least 5 scans to compute anomaly z-scores")
+	}
+	if c.PgstattupleTop < 0 {
+		return errors.New("pgstattuple top must not be negative")
+	}
+	if c.PgstattupleTop > 0 && c.PgstattupleInterval < c.Interval {
+		return errors.New("pgstattuple interval must be greater than polling interval")
+	}
+	if c.PgstattupleTop > 0 && c.PgstattupleBudget <= 0 {
+		return errors.New("pgstattuple budget must be greater than 0")
+	}
 	passwd := os.Getenv("PGPASSWORD")
 	if passwd == "" {
 		return errors.New("PGPASSWORD environment must be set")
@@ -208,6 +379,20 @@ func (c config) Start(ctx context.Context, logger *slog.Logger) (http.Handler, e
 		scannerConfig := scanner.Defaults()
 		scannerConfig.InitialDB = c.InitialDB
 		scannerConfig.Threshold = c.Threshold
+		scannerConfig.Partitions = c.Partitions
+		scannerConfig.Top = c.Top
+		scannerConfig.TopPerSchema = c.TopPerSchema
+		scannerConfig.Bloat = c.Bloat
+		scannerConfig.BloatInterval = c.BloatInterval
+		scannerConfig.PgstattupleTop = c.PgstattupleTop
+		scannerConfig.PgstattupleFull = c.PgstattupleFull
+		scannerConfig.PgstattupleInterval = c.PgstattupleInterval
+		scannerConfig.PgstattupleBudget = c.PgstattupleBudget
+		scannerConfig.GrowthWindow = c.GrowthWindow
+		scannerConfig.Capacity = c.Capacity
+		scannerConfig.TablespaceCapacity = c.TablespaceCapacity
+		scannerConfig.AnomalyZScore = c.AnomalyZScore
+		scannerConfig.AnomalyPercent = c.AnomalyPercent
 		scannerConfig.Exceptions = append(scannerConfig.Exceptions, c.Exceptions...)
 		timer := time.NewTimer(0)
 		for {
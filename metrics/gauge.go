@@ -46,8 +46,13 @@ type batch struct {
 //   - Inside a batch, a metric is updated at most once. I.E. for a
 //     given set of labels, there is a single value in the whole batch.
 //   - The values wont be exposed until the batch is finished.
+//
+// A GaugeBatch created with NewCounterBatch exposes its values as
+// counters instead of gauges. The application is responsible for
+// setting values that are monotonically increasing.
 type GaugeBatch struct {
 	lock       sync.Mutex
+	counter    bool
 	labelNames []string
 	descriptor *prometheus.Desc
 	last       batch
@@ -65,6 +70,7 @@ type gaugeProxy struct {
 	timestamp  *int64
 	label      []*dto.LabelPair
 	gauge      *dto.Gauge
+	counter    *dto.Counter
 }
 
 // Desc implements Metric
@@ -77,6 +83,7 @@ func (g gaugeProxy) Write(m *dto.Metric) error {
 	// Nota: no sé si se supone que esta función debe adquirir el lock del gauge
 	m.TimestampMs = g.timestamp
 	m.Gauge = g.gauge
+	m.Counter = g.counter
 	m.Label = g.label
 	return nil
 }
@@ -91,25 +98,38 @@ func (c *GaugeBatch) Collect(ch chan<- prometheus.Metric) {
 		// para minimizar la reserva de memoria, hago que
 		// todos esos punteros apunten dentro de slices
 		// creadas con tamaño fijo.
-		gauges := make([]dto.Gauge, len(snap.samples))
+		var (
+			gauges   []dto.Gauge
+			counters []dto.Counter
+		)
+		if c.counter {
+			counters = make([]dto.Counter, len(snap.samples))
+		} else {
+			gauges = make([]dto.Gauge, len(snap.samples))
+		}
 		scale := len(c.labelNames)
 		labels := make([]dto.LabelPair, scale*len(snap.samples))
 		lp := make([]*dto.LabelPair, scale*len(snap.samples))
 		for metric_idx := range snap.samples {
 			// Agrego al elemento actual del slice, los valores correspondientes
-			gauges[metric_idx].Value = &snap.samples[metric_idx].value
 			for label_idx := range c.labelNames {
 				labels[metric_idx*scale+label_idx].Name = &c.labelNames[label_idx]
 				labels[metric_idx*scale+label_idx].Value = &snap.samples[metric_idx].labelValues[label_idx]
 				lp[metric_idx*scale+label_idx] = &labels[metric_idx*scale+label_idx]
 			}
-			// Y envío la métrica al canal
 			mp := gaugeProxy{
 				descriptor: c.descriptor,
 				timestamp:  &snap.timestamp,
 				label:      lp[metric_idx*scale : (metric_idx+1)*scale],
-				gauge:      &gauges[metric_idx],
 			}
+			if c.counter {
+				counters[metric_idx].Value = &snap.samples[metric_idx].value
+				mp.counter = &counters[metric_idx]
+			} else {
+				gauges[metric_idx].Value = &snap.samples[metric_idx].value
+				mp.gauge = &gauges[metric_idx]
+			}
+			// Y envío la métrica al canal
 			ch <- mp
 		}
 	}
@@ -147,3 +167,11 @@ func NewGaugeBatch(name string, help string, labels []string) *GaugeBatch {
 	_ = (prometheus.Collector)(gb)
 	return gb
 }
+
+// NewCounterBatch creates a new Gauge Batch collector that exposes
+// its values as counters
+func NewCounterBatch(name string, help string, labels []string) *GaugeBatch {
+	gb := NewGaugeBatch(name, help, labels)
+	gb.counter = true
+	return gb
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// histogramSample represents a single histogram in the batch
+type histogramSample struct {
+	labelValues []string
+	count       uint64
+	sum         float64
+	// buckets holds non-cumulative counts, one per upper bound
+	buckets []uint64
+}
+
+// Batch of histograms identified by the same timestamp
+type histogramBatch struct {
+	timestamp int64
+	samples   []histogramSample
+	index     map[string]int
+}
+
+// HistogramBatch is a set of histograms that we want to treat as a batch
+//
+// It follows the same assumptions as GaugeBatch: the application
+// begins a batch with `Begin`, makes all the observations, and closes
+// the batch with `Commit`. The histograms are not exposed until the
+// batch is finished, and they expose the timestamp when it was.
+//
+// Unlike GaugeBatch, a given set of labels can be observed many times
+// inside a batch. Each batch starts with empty histograms, so
+// the exposed values are not cumulative across batches.
+type HistogramBatch struct {
+	lock       sync.Mutex
+	labelNames []string
+	buckets    []float64
+	descriptor *prometheus.Desc
+	last       histogramBatch
+	current    histogramBatch
+}
+
+// Describe implements prometheus.Collector.
+func (c *HistogramBatch) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.descriptor
+}
+
+// Collect implements prometheus.Collector.
+func (c *HistogramBatch) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	snap := c.last
+	c.lock.Unlock()
+	timestamp := time.UnixMilli(snap.timestamp)
+	for _, s := range snap.samples {
+		cumulative := make(map[float64]uint64, len(c.buckets))
+		acc := uint64(0)
+		for idx, upperBound := range c.buckets {
+			acc += s.buckets[idx]
+			cumulative[upperBound] = acc
+		}
+		h, err := prometheus.NewConstHistogram(c.descriptor, s.count, s.sum, cumulative, s.labelValues...)
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.NewMetricWithTimestamp(timestamp, h)
+	}
+}
+
+// Begin a new batch
+func (c *HistogramBatch) Begin() {
+	c.current.samples = make([]histogramSample, 0, 16)
+	c.current.index = make(map[string]int)
+}
+
+// Commit the current batch
+func (c *HistogramBatch) Commit() {
+	c.current.timestamp = time.Now().UnixMilli()
+	c.lock.Lock()
+	c.last = c.current
+	c.current.samples = nil
+	c.current.index = nil
+	c.lock.Unlock()
+}
+
+// Observe adds a single observation to the histogram with the given labels
+func (c *HistogramBatch) Observe(labelValues []string, value float64) {
+	key := strings.Join(labelValues, "\xff")
+	idx, ok := c.current.index[key]
+	if !ok {
+		idx = len(c.current.samples)
+		c.current.index[key] = idx
+		c.current.samples = append(c.current.samples, histogramSample{
+			labelValues: labelValues,
+			buckets:     make([]uint64, len(c.buckets)),
+		})
+	}
+	s := &c.current.samples[idx]
+	s.count++
+	s.sum += value
+	for bucket, upperBound := range c.buckets {
+		if value <= upperBound {
+			s.buckets[bucket]++
+			break
+		}
+	}
+}
+
+// NewHistogramBatch creates a new Histogram Batch collector
+func NewHistogramBatch(name string, help string, labels []string, buckets []float64) *HistogramBatch {
+	hb := &HistogramBatch{
+		labelNames: labels,
+		buckets:    buckets,
+		descriptor: prometheus.NewDesc(name, help, labels, nil),
+	}
+	// Comprobar que implementamos la interfaz
+	_ = (prometheus.Collector)(hb)
+	return hb
+}
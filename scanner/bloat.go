@@ -0,0 +1,191 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Las consultas de bloat son una adaptación de las estimaciones
+// estadísticas de https://github.com/ioguix/pgsql-bloat-estimation,
+// basadas en pg_stats y pg_class. Requieren que las tablas se hayan
+// analizado, y descartan las que tienen columnas sin estadísticas.
+
+// tableBloat estima el bloat de tablas y vistas materializadas
+func (m Metrics) tableBloat(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, threshold int64) error {
+	query := `
+	SELECT
+		schema,
+		name,
+		(bs * tblpages)::bigint AS real_size,
+		(CASE WHEN tblpages > est_tblpages_ff THEN bs * (tblpages - est_tblpages_ff) ELSE 0 END)::bigint AS bloat_size,
+		(CASE WHEN tblpages > est_tblpages_ff THEN (tblpages - est_tblpages_ff) / tblpages ELSE 0 END)::float8 AS bloat_ratio
+	FROM (
+		SELECT
+			ceil(reltuples / ((bs - page_hdr) * fillfactor / (tpl_size * 100))) + ceil(toasttuples / 4) AS est_tblpages_ff,
+			heappages + toastpages AS tblpages,
+			bs, schema, name, is_na
+		FROM (
+			SELECT
+				(4 + tpl_hdr_size + tpl_data_size + (2 * ma)
+					- CASE WHEN tpl_hdr_size % ma = 0 THEN ma ELSE tpl_hdr_size % ma END
+					- CASE WHEN ceil(tpl_data_size)::int % ma = 0 THEN ma ELSE ceil(tpl_data_size)::int % ma END
+				) AS tpl_size,
+				heappages, toastpages, reltuples, toasttuples, bs, page_hdr, schema, name, fillfactor, is_na
+			FROM (
+				SELECT
+					n.nspname AS schema,
+					tbl.relname AS name,
+					greatest(tbl.reltuples, 0) AS reltuples,
+					tbl.relpages AS heappages,
+					coalesce(toast.relpages, 0) AS toastpages,
+					coalesce(greatest(toast.reltuples, 0), 0) AS toasttuples,
+					coalesce(substring(array_to_string(tbl.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 100) AS fillfactor,
+					current_setting('block_size')::numeric AS bs,
+					CASE WHEN version() ~ 'mingw32|64-bit|x86_64|ppc64|ia64|amd64|aarch64' THEN 8 ELSE 4 END AS ma,
+					24 AS page_hdr,
+					23 + CASE WHEN max(coalesce(s.null_frac, 0)) > 0 THEN (7 + count(s.attname)) / 8 ELSE 0 END AS tpl_hdr_size,
+					sum((1 - coalesce(s.null_frac, 0)) * coalesce(s.avg_width, 0)) AS tpl_data_size,
+					bool_or(att.atttypid = 'pg_catalog.name'::regtype) OR count(*) <> count(s.attname) AS is_na
+				FROM pg_attribute att
+				JOIN pg_class tbl ON tbl.oid = att.attrelid
+				JOIN pg_namespace n ON n.oid = tbl.relnamespace
+				LEFT JOIN pg_stats s
+				ON s.schemaname = n.nspname AND s.tablename = tbl.relname AND NOT s.inherited AND s.attname = att.attname
+				LEFT JOIN pg_class toast ON toast.oid = tbl.reltoastrelid
+				WHERE NOT att.attisdropped AND att.attnum > 0 AND tbl.relkind IN ('r', 'm')
+				GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10
+			) s1
+		) s2
+	) s3
+	WHERE NOT is_na
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema     string
+			name       string
+			real_size  int64
+			bloat_size int64
+			ratio      float64
+		)
+		if err := rows.Scan(&schema, &name, &real_size, &bloat_size, &ratio); err != nil {
+			return err
+		}
+		if real_size < threshold {
+			return nil
+		}
+		labels := []string{database, schema, name}
+		m.bloat.gauges[tableBloatBytesGauge].Set(labels, float64(bloat_size))
+		m.bloat.gauges[tableBloatRatioGauge].Set(labels, ratio)
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// indexBloat estima el bloat de los índices btree
+func (m Metrics) indexBloat(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, threshold int64) error {
+	query := `
+	SELECT
+		schema,
+		tblname,
+		idxname,
+		(bs * relpages)::bigint AS real_size,
+		(CASE WHEN relpages > est_pages_ff THEN bs * (relpages - est_pages_ff) ELSE 0 END)::bigint AS bloat_size
+	FROM (
+		SELECT
+			coalesce(1 + ceil(reltuples / floor((bs - pageopqdata - pagehdr) * fillfactor / (100 * (4 + nulldatahdrwidth)::float))), 0) AS est_pages_ff,
+			bs, schema, tblname, idxname, relpages, is_na
+		FROM (
+			SELECT
+				bs, schema, tblname, idxname, reltuples, relpages, fillfactor, pagehdr, pageopqdata, is_na,
+				(index_tuple_hdr_bm + maxalign
+					- CASE WHEN index_tuple_hdr_bm % maxalign = 0 THEN maxalign ELSE index_tuple_hdr_bm % maxalign END
+					+ nulldatawidth + maxalign
+					- CASE
+						WHEN nulldatawidth = 0 THEN 0
+						WHEN nulldatawidth::integer % maxalign = 0 THEN maxalign
+						ELSE nulldatawidth::integer % maxalign
+					END
+				)::numeric AS nulldatahdrwidth
+			FROM (
+				SELECT
+					n.nspname AS schema,
+					i.tblname,
+					i.idxname,
+					i.reltuples,
+					i.relpages,
+					i.fillfactor,
+					current_setting('block_size')::numeric AS bs,
+					CASE WHEN version() ~ 'mingw32|64-bit|x86_64|ppc64|ia64|amd64|aarch64' THEN 8 ELSE 4 END AS maxalign,
+					24 AS pagehdr,
+					16 AS pageopqdata,
+					CASE WHEN max(coalesce(s.null_frac, 0)) = 0 THEN 8 ELSE 8 + ((32 + 8 - 1) / 8) END AS index_tuple_hdr_bm,
+					sum((1 - coalesce(s.null_frac, 0)) * coalesce(s.avg_width, 1024)) AS nulldatawidth,
+					bool_or(i.atttypid = 'pg_catalog.name'::regtype) AS is_na
+				FROM (
+					SELECT
+						ct.relname AS tblname,
+						ct.relnamespace,
+						ic.idxname,
+						ic.reltuples,
+						ic.relpages,
+						ic.fillfactor,
+						coalesce(a1.attname, a2.attname) AS attname,
+						coalesce(a1.atttypid, a2.atttypid) AS atttypid,
+						CASE WHEN a1.attnum IS NULL THEN ic.idxname ELSE ct.relname END AS attrelname
+					FROM (
+						SELECT
+							ci.relname AS idxname,
+							greatest(ci.reltuples, 0) AS reltuples,
+							ci.relpages,
+							x.indrelid AS tbloid,
+							x.indexrelid AS idxoid,
+							coalesce(substring(array_to_string(ci.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 90) AS fillfactor,
+							string_to_array(x.indkey::text, ' ')::int2[] AS indkey,
+							generate_series(1, x.indnatts) AS attpos
+						FROM pg_index x
+						JOIN pg_class ci ON ci.oid = x.indexrelid
+						JOIN pg_am a ON a.oid = ci.relam
+						WHERE a.amname = 'btree' AND ci.relpages > 0
+					) ic
+					JOIN pg_class ct ON ct.oid = ic.tbloid
+					LEFT JOIN pg_attribute a1
+					ON ic.indkey[ic.attpos] <> 0 AND a1.attrelid = ic.tbloid AND a1.attnum = ic.indkey[ic.attpos]
+					LEFT JOIN pg_attribute a2
+					ON ic.indkey[ic.attpos] = 0 AND a2.attrelid = ic.idxoid AND a2.attnum = ic.attpos
+				) i
+				JOIN pg_namespace n ON n.oid = i.relnamespace
+				JOIN pg_stats s
+				ON s.schemaname = n.nspname AND s.tablename = i.attrelname AND s.attname = i.attname
+				GROUP BY 1, 2, 3, 4, 5, 6, 7, 8, 9, 10
+			) s1
+		) s2
+	) s3
+	WHERE NOT is_na
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema     string
+			table      string
+			name       string
+			real_size  int64
+			bloat_size int64
+		)
+		if err := rows.Scan(&schema, &table, &name, &real_size, &bloat_size); err != nil {
+			return err
+		}
+		if real_size < threshold {
+			return nil
+		}
+		m.bloat.gauges[indexBloatBytesGauge].Set([]string{database, schema, table, name}, float64(bloat_size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package scanner
+
+import (
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// sizeSample es una medida de tamaño en un instante
+type sizeSample struct {
+	at   time.Time
+	size float64
+}
+
+// sizeHistory es el histórico reciente de tamaños de una serie
+type sizeHistory struct {
+	samples []sizeSample
+	// último Scan en el que se observó la serie
+	scan int
+}
+
+// growth guarda, en memoria, los tamaños observados en los últimos
+// Scan para estimar el ritmo de crecimiento de cada serie.
+//
+// Con scans espaciados y timestamps explícitos, deriv() en PromQL
+// resulta muy ruidoso. En su lugar, se ajusta una recta por mínimos
+// cuadrados a las últimas `window` muestras de cada serie.
+type growth struct {
+	window int
+	scan   int
+	series map[string]*sizeHistory
+}
+
+func newGrowth() *growth {
+	return &growth{
+		series: make(map[string]*sizeHistory),
+	}
+}
+
+// begin inicia un nuevo Scan, con el tamaño de ventana configurado
+func (g *growth) begin(window int) {
+	g.window = max(window, 2)
+	g.scan++
+}
+
+// prune descarta las series que no se han observado en toda la ventana
+func (g *growth) prune() {
+	for key, history := range g.series {
+		if g.scan-history.scan >= g.window {
+			delete(g.series, key)
+		}
+	}
+}
+
+// observe añade una muestra a la serie identificada por las etiquetas, y
+// devuelve su ritmo de crecimiento en bytes por segundo. Si no hay
+// suficientes muestras, devuelve false.
+func (g *growth) observe(labels []string, at time.Time, size float64) (float64, bool) {
+	key := strings.Join(labels, "\xff")
+	history, ok := g.series[key]
+	if !ok {
+		history = &sizeHistory{}
+		g.series[key] = history
+	}
+	history.scan = g.scan
+	history.samples = append(history.samples, sizeSample{at: at, size: size})
+	if extra := len(history.samples) - g.window; extra > 0 {
+		history.samples = history.samples[extra:]
+	}
+	return slope(history.samples)
+}
+
+// slope calcula la pendiente de la recta de mínimos cuadrados
+func slope(samples []sizeSample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	origin := samples[0].at
+	n := float64(len(samples))
+	var meanT, meanS float64
+	for _, s := range samples {
+		meanT += s.at.Sub(origin).Seconds()
+		meanS += s.size
+	}
+	meanT, meanS = meanT/n, meanS/n
+	var num, den float64
+	for _, s := range samples {
+		dt := s.at.Sub(origin).Seconds() - meanT
+		num += dt * (s.size - meanS)
+		den += dt * dt
+	}
+	if den == 0 {
+		return 0, false
+	}
+	return num / den, true
+}
+
+const (
+	// minZScoreRates es el número mínimo de ritmos anteriores al último
+	// para calcular el z-score. Requiere minZScoreRates + 2 muestras.
+	minZScoreRates = 3
+	// minStddevRatio es la desviación típica mínima, en proporción al
+	// ritmo de crecimiento medio
+	minStddevRatio = 0.1
+	// minStddevBytes es la desviación típica mínima, en bytes por
+	// intervalo entre muestras
+	minStddevBytes = units.MB
+)
+
+// change describe el último cambio de tamaño de una serie
+type change struct {
+	// crecimiento relativo (en %) respecto a la muestra anterior
+	percent    float64
+	hasPercent bool
+	// z-score del último ritmo de crecimiento, respecto a los ritmos
+	// anteriores de la ventana
+	zscore    float64
+	hasZScore bool
+}
+
+// lastChange calcula el último cambio de tamaño de la serie. Devuelve
+// false si todavía no hay al menos dos muestras.
+func (g *growth) lastChange(labels []string) (change, bool) {
+	history, ok := g.series[strings.Join(labels, "\xff")]
+	if !ok || len(history.samples) < 2 {
+		return change{}, false
+	}
+	samples := history.samples
+	rates := make([]float64, 0, len(samples)-1)
+	for i := 1; i < len(samples); i++ {
+		elapsed := samples[i].at.Sub(samples[i-1].at).Seconds()
+		if elapsed <= 0 {
+			return change{}, false
+		}
+		rates = append(rates, (samples[i].size-samples[i-1].size)/elapsed)
+	}
+	var c change
+	if previous := samples[len(samples)-2].size; previous > 0 {
+		c.percent = 100 * (samples[len(samples)-1].size - previous) / previous
+		c.hasPercent = true
+	}
+	// Hacen falta varios ritmos anteriores para que la desviación
+	// típica tenga sentido.
+	if previous := rates[:len(rates)-1]; len(previous) >= minZScoreRates {
+		var mean, variance float64
+		for _, rate := range previous {
+			mean += rate
+		}
+		mean /= float64(len(previous))
+		for _, rate := range previous {
+			variance += (rate - mean) * (rate - mean)
+		}
+		// Las tablas que no crecen, o que crecen a un ritmo muy constante,
+		// tienen una desviación típica nula o minúscula, y cualquier pequeña
+		// variación dispararía el z-score. Se acota por abajo, en proporción
+		// al ritmo medio y en bytes por intervalo entre muestras.
+		elapsed := samples[len(samples)-1].at.Sub(samples[0].at).Seconds() / float64(len(rates))
+		stddev := max(math.Sqrt(variance/float64(len(previous))), minStddevRatio*math.Abs(mean), minStddevBytes/elapsed)
+		c.zscore = (rates[len(rates)-1] - mean) / stddev
+		c.hasZScore = true
+	}
+	return c, true
+}
+
+// anomaly comprueba si el último crecimiento de la tabla es anómalo, bien
+// porque su z-score supera AnomalyZScore, bien porque ha crecido más de
+// AnomalyPercent. Solo se tienen en cuenta los crecimientos, no las
+// reducciones de tamaño.
+func (m Metrics) anomaly(logger *slog.Logger, database string, t tableRow, cfg Config) {
+	if cfg.AnomalyZScore <= 0 && cfg.AnomalyPercent <= 0 {
+		return
+	}
+	labels := []string{database, t.schema, t.name, t.kind}
+	c, ok := m.growth.lastChange(append([]string{"table"}, labels...))
+	if !ok {
+		return
+	}
+	byZScore := cfg.AnomalyZScore > 0 && c.hasZScore && c.zscore > cfg.AnomalyZScore
+	byPercent := cfg.AnomalyPercent > 0 && c.hasPercent && c.percent > cfg.AnomalyPercent
+	anomalous := 0.0
+	if byZScore || byPercent {
+		anomalous = 1
+		logger.Warn("table size anomaly",
+			"op", "anomaly",
+			"schema", t.schema,
+			"name", t.name,
+			"kind", t.kind,
+			"size", t.totalSize,
+			"percent", c.percent,
+			"zscore", c.zscore,
+		)
+	}
+	m.gauges[tableAnomalyGauge].Set(labels, anomalous)
+}
+
+// forecastDays estima los días que faltan para alcanzar la capacidad,
+// al ritmo de crecimiento dado. Si no está creciendo, devuelve false.
+func forecastDays(size, capacity, rate float64) (float64, bool) {
+	if rate <= 0 {
+		return 0, false
+	}
+	return max(capacity-size, 0) / rate / (24 * 60 * 60), true
+}
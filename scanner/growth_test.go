@@ -0,0 +1,183 @@
+package scanner
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// samplesEvery genera muestras con los tamaños dados, separadas por step
+func samplesEvery(step time.Duration, sizes ...float64) []sizeSample {
+	origin := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := make([]sizeSample, 0, len(sizes))
+	for i, size := range sizes {
+		samples = append(samples, sizeSample{at: origin.Add(time.Duration(i) * step), size: size})
+	}
+	return samples
+}
+
+// historyOf crea un growth con una única serie con las muestras dadas
+func historyOf(samples []sizeSample) *growth {
+	g := newGrowth()
+	g.begin(len(samples))
+	for _, s := range samples {
+		g.observe([]string{"t"}, s.at, s.size)
+	}
+	return g
+}
+
+func TestSlope(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []sizeSample
+		want    float64
+		ok      bool
+	}{
+		{"empty", nil, 0, false},
+		{"single sample", samplesEvery(time.Second, 100), 0, false},
+		{"same instant", []sizeSample{{size: 1}, {size: 2}}, 0, false},
+		{"flat", samplesEvery(time.Second, 100, 100, 100), 0, true},
+		{"linear", samplesEvery(10*time.Second, 0, 100, 200, 300), 10, true},
+		{"shrinking", samplesEvery(time.Second, 300, 200, 100), -100, true},
+		{"least squares", samplesEvery(time.Second, 0, 2, 1, 3), 0.8, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := slope(tt.samples)
+			if ok != tt.ok {
+				t.Fatalf("slope() ok = %v, want %v", ok, tt.ok)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("slope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastChange(t *testing.T) {
+	const (
+		// minStddevBytes usa megabytes decimales
+		mb = 1000 * 1000
+		gb = 1 << 30
+	)
+	step := 30 * time.Minute
+	tests := []struct {
+		name       string
+		samples    []sizeSample
+		ok         bool
+		hasPercent bool
+		percent    float64
+		hasZScore  bool
+		// el z-score se comprueba con un rango, porque depende de las cotas
+		minZScore float64
+		maxZScore float64
+	}{
+		{
+			name:    "single sample",
+			samples: samplesEvery(step, gb),
+		},
+		{
+			name:       "too few samples for zscore",
+			samples:    samplesEvery(step, gb, gb, gb, 2*gb),
+			ok:         true,
+			hasPercent: true,
+			percent:    100,
+		},
+		{
+			// Unas pocas páginas nuevas en una tabla estática no son anómalas
+			name:       "small jump after flat history",
+			samples:    samplesEvery(step, gb, gb, gb, gb, gb+pages(8)),
+			ok:         true,
+			hasPercent: true,
+			percent:    100 * pages(8) / gb,
+			hasZScore:  true,
+			minZScore:  0,
+			maxZScore:  0.1,
+		},
+		{
+			name:       "large jump after flat history",
+			samples:    samplesEvery(step, gb, gb, gb, gb, gb+10*mb),
+			ok:         true,
+			hasPercent: true,
+			percent:    100.0 * 10 * mb / gb,
+			hasZScore:  true,
+			minZScore:  9.9,
+			maxZScore:  10.1,
+		},
+		{
+			name:       "flat history",
+			samples:    samplesEvery(step, gb, gb, gb, gb, gb),
+			ok:         true,
+			hasPercent: true,
+			hasZScore:  true,
+		},
+		{
+			name:       "shrink after flat history",
+			samples:    samplesEvery(step, gb, gb, gb, gb, gb/2),
+			ok:         true,
+			hasPercent: true,
+			percent:    -50,
+			hasZScore:  true,
+			minZScore:  -537,
+			maxZScore:  -536,
+		},
+		{
+			// Crecimiento constante de 1GB con pequeñas variaciones:
+			// la cota inferior de la desviación típica evita el falso positivo
+			name:       "steady growth wobble",
+			samples:    samplesEvery(step, gb, 2*gb, 3*gb+pages(1), 4*gb, 5*gb+pages(2)),
+			ok:         true,
+			hasPercent: true,
+			percent:    100 * (gb + pages(2)) / (4 * gb),
+			hasZScore:  true,
+			minZScore:  0,
+			maxZScore:  0.1,
+		},
+		{
+			name:       "runaway growth",
+			samples:    samplesEvery(step, gb, 2*gb+pages(1), 3*gb, 4*gb, 9*gb),
+			ok:         true,
+			hasPercent: true,
+			percent:    125,
+			hasZScore:  true,
+			minZScore:  39,
+			maxZScore:  41,
+		},
+		{
+			name:       "small wobble on flat history",
+			samples:    samplesEvery(step, gb, gb+pages(1), gb, gb+pages(1), gb+pages(2)),
+			ok:         true,
+			hasPercent: true,
+			percent:    100 * pages(1) / (gb + pages(1)),
+			hasZScore:  true,
+			minZScore:  0,
+			maxZScore:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := historyOf(tt.samples)
+			c, ok := g.lastChange([]string{"t"})
+			if ok != tt.ok {
+				t.Fatalf("lastChange() ok = %v, want %v", ok, tt.ok)
+			}
+			if c.hasPercent != tt.hasPercent {
+				t.Fatalf("lastChange() hasPercent = %v, want %v", c.hasPercent, tt.hasPercent)
+			}
+			if math.Abs(c.percent-tt.percent) > 1e-9 {
+				t.Errorf("lastChange() percent = %v, want %v", c.percent, tt.percent)
+			}
+			if c.hasZScore != tt.hasZScore {
+				t.Fatalf("lastChange() hasZScore = %v, want %v", c.hasZScore, tt.hasZScore)
+			}
+			if c.zscore < tt.minZScore || c.zscore > tt.maxZScore {
+				t.Errorf("lastChange() zscore = %v, want between %v and %v", c.zscore, tt.minZScore, tt.maxZScore)
+			}
+		})
+	}
+}
+
+// pages devuelve el tamaño en bytes de n páginas de 8kB
+func pages(n float64) float64 {
+	return n * 8192
+}
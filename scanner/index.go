@@ -0,0 +1,325 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// index recopila métricas individuales de los índices
+//
+// Solo se informa de los índices de las tablas que ha devuelto table
+// (o de sus chunks y particiones).
+func (m Metrics) index(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, tables []tableRow, threshold int64, ts bool) error {
+	query := relationsQuery(ts) + `
+	SELECT
+		r.schema,
+		r.name,
+		r.kind,
+		n.nspname AS table_schema,
+		t.relname AS table_name,
+		i.relname AS index_name,
+		a.amname AS index_method,
+		x.indisunique AS is_unique,
+		x.indisprimary AS is_primary,
+		pg_relation_size(i.oid) AS index_size
+	FROM pg_index x
+	JOIN pg_class i ON i.oid = x.indexrelid
+	JOIN pg_class t ON t.oid = x.indrelid
+	JOIN pg_namespace n ON n.oid = t.relnamespace
+	JOIN pg_am a ON a.oid = i.relam
+	JOIN relations r ON r.oid = t.oid
+	`
+	selected := tableSet(tables)
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			key       tableKey
+			schema    string
+			table     string
+			name      string
+			method    string
+			isUnique  bool
+			isPrimary bool
+			size      int64
+		)
+		if err := rows.Scan(&key.schema, &key.name, &key.kind, &schema, &table, &name, &method, &isUnique, &isPrimary, &size); err != nil {
+			return err
+		}
+		if size < threshold || !selected[key] {
+			return nil
+		}
+		labels := []string{database, schema, table, name, method, strconv.FormatBool(isUnique), strconv.FormatBool(isPrimary)}
+		m.gauges[indexSizeGauge].Set(labels, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// indexRootsQuery genera las CTE `index_parents` e `index_roots`, que
+// asocian cada índice con el índice raíz del que deriva: el índice de la
+// tabla particionada raíz para los índices de las particiones (a cualquier
+// nivel), o el de la hypertabla para los de los chunks. El resto de índices
+// son su propia raíz. Se debe añadir a continuación de relationsQuery.
+//
+// Los índices de los chunks solo se asocian a su hypertabla si existe el
+// catálogo chunk_index (ver hasChunkIndex).
+func indexRootsQuery(chunkIndex bool) string {
+	chunks := ""
+	if chunkIndex {
+		chunks = "UNION ALL" + timescaleIndexParents
+	}
+	return `,
+	index_parents AS (
+		SELECT i.inhrelid AS oid, i.inhparent AS parent
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE c.relkind IN ('i', 'I')
+		` + chunks + `
+	),
+	index_roots AS (
+		SELECT c.oid, c.oid AS root
+		FROM pg_class c
+		WHERE c.relkind IN ('i', 'I')
+		AND NOT EXISTS (SELECT 1 FROM index_parents p WHERE p.oid = c.oid)
+		UNION ALL
+		SELECT p.oid, r.root
+		FROM index_roots r
+		JOIN index_parents p ON p.parent = r.oid
+	)
+	`
+}
+
+// indexHealth recopila los índices que ocupan espacio sin aportar nada:
+// índices sin usar, redundantes o inválidos, junto con las claves
+// ajenas que no tienen un índice que las soporte.
+//
+// Las tablas se identifican igual que en table (schema, name y kind),
+// agrupando los chunks y particiones bajo su hypertabla o tabla raíz, y
+// los índices sin usar y redundantes se agrupan bajo su índice raíz
+// (ver indexRootsQuery) antes de aplicar el umbral. Solo se informa de
+// las tablas que ha devuelto table.
+func (m Metrics) indexHealth(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, tables []tableRow, threshold int64, ts bool) error {
+	selected := tableSet(tables)
+	chunkIndex := false
+	if ts {
+		var err error
+		if chunkIndex, err = hasChunkIndex(ctx, logger, conn); err != nil {
+			return err
+		}
+	}
+	// Índices no usados desde el último reset de estadísticas, sumando
+	// los usos y el tamaño de todos los índices que derivan del mismo
+	// índice raíz. Se excluyen los que respaldan restricciones (únicas,
+	// de exclusión...), porque aunque no se usen para consultas no se
+	// pueden eliminar.
+	query := relationsQuery(ts) + indexRootsQuery(chunkIndex) + `
+	SELECT
+		r.schema,
+		r.name,
+		r.kind,
+		i.relname AS index_name,
+		SUM(pg_relation_size(ir.oid)) AS index_size
+	FROM index_roots ir
+	JOIN pg_index x ON x.indexrelid = ir.root
+	JOIN pg_class i ON i.oid = ir.root
+	JOIN relations r ON r.oid = x.indrelid
+	LEFT JOIN pg_stat_all_indexes s ON s.indexrelid = ir.oid
+	WHERE x.indisvalid
+	AND NOT x.indisunique
+	AND r.schema NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+	AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = x.indexrelid)
+	GROUP BY 1, 2, 3, 4
+	HAVING coalesce(SUM(s.idx_scan), 0) = 0
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema string
+			name   string
+			kind   string
+			index  string
+			size   int64
+		)
+		if err := rows.Scan(&schema, &name, &kind, &index, &size); err != nil {
+			return err
+		}
+		if size < threshold || !selected[tableKey{schema: schema, name: name, kind: kind}] {
+			return nil
+		}
+		m.gauges[indexUnusedSizeGauge].Set([]string{database, schema, name, kind, index}, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	// Un índice raíz "a" es redundante con otro "b" de la misma tabla y
+	// método si sus columnas (y clases de operadores) son un prefijo de las
+	// de "b", y ninguno tiene expresiones ni predicados. Solo los btree
+	// pueden aprovechar un prefijo, para el resto se exige que sean
+	// idénticos. Un índice único solo es redundante con otro único
+	// idéntico, y entre dos idénticos se señala el de oid mayor
+	// (normalmente el más reciente).
+	//
+	// Si hay varios índices que cubren a "a", se informa solo del que
+	// tiene más columnas, para que cada índice redundante cuente una vez.
+	// El tamaño incluye el de todos los índices que derivan de "a".
+	query = relationsQuery(ts) + indexRootsQuery(chunkIndex) + `,
+	redundant AS (
+		SELECT DISTINCT ON (a.indexrelid)
+			a.indexrelid,
+			a.indrelid,
+			bi.root AS covering
+		FROM pg_index a
+		JOIN index_roots ai ON ai.oid = a.indexrelid AND ai.root = a.indexrelid
+		JOIN pg_index b ON b.indrelid = a.indrelid AND b.indexrelid <> a.indexrelid
+		JOIN index_roots bi ON bi.oid = b.indexrelid
+		JOIN pg_class ia ON ia.oid = a.indexrelid
+		JOIN pg_class ib ON ib.oid = b.indexrelid
+		JOIN pg_am am ON am.oid = ia.relam
+		WHERE ia.relam = ib.relam
+		AND a.indisvalid AND b.indisvalid
+		AND NOT a.indisprimary
+		AND a.indexprs IS NULL AND b.indexprs IS NULL
+		AND a.indpred IS NULL AND b.indpred IS NULL
+		AND (b.indkey::text || ' ') LIKE (a.indkey::text || ' %')
+		AND (b.indclass::text || ' ') LIKE (a.indclass::text || ' %')
+		AND (
+			(a.indkey::text <> b.indkey::text AND am.amname = 'btree' AND NOT a.indisunique)
+			OR (a.indkey::text = b.indkey::text AND a.indclass::text = b.indclass::text AND (
+				(NOT a.indisunique AND b.indisunique)
+				OR (a.indisunique = b.indisunique AND a.indexrelid > b.indexrelid)
+			))
+		)
+		ORDER BY a.indexrelid, b.indnatts DESC, b.indexrelid
+	)
+	SELECT
+		r.schema,
+		r.name,
+		r.kind,
+		ia.relname AS index_name,
+		ib.relname AS covered_by,
+		SUM(pg_relation_size(ir.oid)) AS index_size
+	FROM redundant x
+	JOIN index_roots ir ON ir.root = x.indexrelid
+	JOIN relations r ON r.oid = x.indrelid
+	JOIN pg_class ia ON ia.oid = x.indexrelid
+	JOIN pg_class ib ON ib.oid = x.covering
+	WHERE r.schema NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+	GROUP BY 1, 2, 3, 4, 5
+	`
+	scanner = func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema    string
+			name      string
+			kind      string
+			index     string
+			coveredBy string
+			size      int64
+		)
+		if err := rows.Scan(&schema, &name, &kind, &index, &coveredBy, &size); err != nil {
+			return err
+		}
+		if size < threshold || !selected[tableKey{schema: schema, name: name, kind: kind}] {
+			return nil
+		}
+		m.gauges[indexRedundantSizeGauge].Set([]string{database, schema, name, kind, index, coveredBy}, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	// Índices inválidos, normalmente restos de un CREATE INDEX CONCURRENTLY
+	// fallido. Ocupan espacio y se mantienen en cada escritura, pero no se
+	// usan en las consultas.
+	query = relationsQuery(ts) + `
+	SELECT
+		r.schema,
+		r.name,
+		r.kind,
+		i.relname AS index_name,
+		SUM(pg_relation_size(i.oid)) AS index_size
+	FROM pg_index x
+	JOIN pg_class i ON i.oid = x.indexrelid
+	JOIN relations r ON r.oid = x.indrelid
+	WHERE NOT x.indisvalid
+	GROUP BY 1, 2, 3, 4
+	`
+	scanner = func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema string
+			name   string
+			kind   string
+			index  string
+			size   int64
+		)
+		if err := rows.Scan(&schema, &name, &kind, &index, &size); err != nil {
+			return err
+		}
+		if size < threshold || !selected[tableKey{schema: schema, name: name, kind: kind}] {
+			return nil
+		}
+		m.gauges[indexInvalidSizeGauge].Set([]string{database, schema, name, kind, index}, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	// Claves ajenas sin un índice válido cuyas primeras columnas sean
+	// las de la clave (en cualquier orden). El tamaño que se reporta es
+	// el de la tabla (con todos sus chunks o particiones) que hay que
+	// recorrer al borrar o actualizar la tabla referenciada.
+	//
+	// Solo se comprueban las claves de la tabla raíz, porque las de los
+	// chunks y particiones (que heredan de ella) son copias suyas.
+	query = relationsQuery(ts) + `,
+	sizes AS (
+		SELECT schema, name, kind, SUM(pg_relation_size(oid)) AS size
+		FROM relations
+		GROUP BY 1, 2, 3
+	)
+	SELECT
+		r.schema,
+		r.name,
+		r.kind,
+		c.conname AS constraint_name,
+		s.size AS table_size
+	FROM pg_constraint c
+	JOIN relations r ON r.oid = c.conrelid
+	JOIN sizes s ON s.schema = r.schema AND s.name = r.name AND s.kind = r.kind
+	WHERE c.contype = 'f'
+	AND NOT EXISTS (SELECT 1 FROM pg_inherits i WHERE i.inhrelid = c.conrelid)
+	AND NOT EXISTS (
+		SELECT 1
+		FROM pg_index x
+		WHERE x.indrelid = c.conrelid
+		AND x.indisvalid
+		AND x.indpred IS NULL
+		AND (string_to_array(x.indkey::text, ' ')::int2[])[1:array_length(c.conkey, 1)] @> c.conkey
+	)
+	`
+	scanner = func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema     string
+			name       string
+			kind       string
+			constraint string
+			size       int64
+		)
+		if err := rows.Scan(&schema, &name, &kind, &constraint, &size); err != nil {
+			return err
+		}
+		if size < threshold || !selected[tableKey{schema: schema, name: name, kind: kind}] {
+			return nil
+		}
+		m.gauges[foreignKeyUnindexedGauge].Set([]string{database, schema, name, kind, constraint}, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
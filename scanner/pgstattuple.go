@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgstattupleSchema devuelve el esquema donde está instalada la extensión
+// pgstattuple, o "" si no está instalada.
+func pgstattupleSchema(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) (string, error) {
+	schema := ""
+	query := "SELECT n.nspname FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = 'pgstattuple'"
+	rscan := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		return rows.Scan(&schema)
+	}
+	if err := doQuery(ctx, logger, conn, query, rscan); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// setStatementTimeout limita la duración de las siguientes consultas
+// de la sesión (0 para no limitarla).
+func setStatementTimeout(ctx context.Context, conn *pgx.Conn, timeout time.Duration) error {
+	_, err := conn.Exec(ctx, "SELECT set_config('statement_timeout', $1, false)", strconv.FormatInt(timeout.Milliseconds(), 10))
+	return err
+}
+
+// tupleStats mide con pgstattuple las `top` tablas más grandes de entre
+// las que ha encontrado table, hasta agotar el presupuesto de tiempo.
+// El tiempo empleado se descuenta del presupuesto, que se comparte entre
+// todas las bases de datos del Scan.
+//
+// Por defecto se usa pgstattuple_approx, que evita leer las páginas
+// marcadas como visibles en el visibility map. Con `full`, se usa
+// pgstattuple, que lee la tabla completa.
+func (m Metrics) tupleStats(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, tables []tableRow, top int, full bool, budget *time.Duration) error {
+	schema, err := pgstattupleSchema(ctx, logger, conn)
+	if err != nil {
+		return err
+	}
+	if schema == "" {
+		logger.Debug("Database does not have pgstattuple extension")
+		return nil
+	}
+	// Solo tiene sentido para relaciones individuales, no para
+	// hypertablas o tablas particionadas.
+	candidates := make([]tableRow, 0, len(tables))
+	for _, table := range tables {
+		if table.kind == "rel" || table.kind == "matview" {
+			candidates = append(candidates, table)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b tableRow) int {
+		return cmp.Compare(b.totalSize, a.totalSize)
+	})
+	if len(candidates) > top {
+		candidates = candidates[:top]
+	}
+	var query string
+	if full {
+		query = "SELECT free_space, dead_tuple_len, tuple_percent FROM " + pgx.Identifier{schema, "pgstattuple"}.Sanitize() + "($1::regclass)"
+	} else {
+		query = "SELECT approx_free_space, dead_tuple_len, approx_tuple_percent FROM " + pgx.Identifier{schema, "pgstattuple_approx"}.Sanitize() + "($1::regclass)"
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if *budget < time.Millisecond {
+		logger.Warn("pgstattuple time budget exhausted")
+		return nil
+	}
+	start := time.Now()
+	deadline := start.Add(*budget)
+	defer func() {
+		*budget = max(*budget-time.Since(start), 0)
+		if err := setStatementTimeout(ctx, conn, 0); err != nil {
+			logger.Error(err.Error(), "op", "statement_timeout")
+		}
+	}()
+	for _, table := range candidates {
+		remaining := time.Until(deadline)
+		if remaining < time.Millisecond {
+			logger.Warn("pgstattuple time budget exhausted", "schema", table.schema, "name", table.name)
+			return nil
+		}
+		if err := setStatementTimeout(ctx, conn, remaining); err != nil {
+			logger.Error(err.Error(), "op", "statement_timeout")
+			return err
+		}
+		scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+			var (
+				freeSpace    int64
+				deadTupleLen int64
+				tuplePercent float64
+			)
+			if err := rows.Scan(&freeSpace, &deadTupleLen, &tuplePercent); err != nil {
+				return err
+			}
+			labels := []string{database, table.schema, table.name}
+			m.pgstattuple.gauges[pgstattupleFreeSpaceGauge].Set(labels, float64(freeSpace))
+			m.pgstattuple.gauges[pgstattupleDeadTupleLenGauge].Set(labels, float64(deadTupleLen))
+			m.pgstattuple.gauges[pgstattupleTuplePercentGauge].Set(labels, tuplePercent)
+			return nil
+		}
+		relation := pgx.Identifier{table.schema, table.name}.Sanitize()
+		if err := doQuery(ctx, logger, conn, query, scanner, relation); err != nil {
+			// query_canceled: se ha agotado el presupuesto de tiempo
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "57014" {
+				logger.Warn("pgstattuple time budget exhausted", "schema", table.schema, "name", table.name)
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -1,58 +1,337 @@
 package scanner
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"log/slog"
 	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/jackc/pgx/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/warpcomdev/pgexport/metrics"
 )
 
 type Metrics struct {
-	gauges []*metrics.GaugeBatch
+	gauges      []*metrics.GaugeBatch
+	histograms  []*metrics.HistogramBatch
+	bloat       *schedule
+	pgstattuple *schedule
+	growth      *growth
 }
 
 func (m Metrics) begin() {
 	for _, gauge := range m.gauges {
 		gauge.Begin()
 	}
+	for _, histogram := range m.histograms {
+		histogram.Begin()
+	}
 }
 
 func (m Metrics) commit() {
 	for _, gauge := range m.gauges {
 		gauge.Commit()
 	}
+	for _, histogram := range m.histograms {
+		histogram.Commit()
+	}
+}
+
+// schedule agrupa métricas que se recopilan con su propio intervalo,
+// más largo que el del resto por ser más costosas. Sus valores se
+// mantienen entre un Scan y el siguiente hasta que vuelve a tocar.
+type schedule struct {
+	gauges []*metrics.GaugeBatch
+	last   time.Time
+}
+
+// due comprueba si ha pasado el intervalo desde la última recopilación
+func (s *schedule) due(interval time.Duration) bool {
+	return s.last.IsZero() || time.Since(s.last) >= interval
+}
+
+func (s *schedule) begin() {
+	for _, gauge := range s.gauges {
+		gauge.Begin()
+	}
+}
+
+// commit publica la recopilación en curso, y reinicia el intervalo.
+// Si no se llega a llamar, se mantienen los valores anteriores y la
+// recopilación se reintenta en el siguiente Scan.
+func (s *schedule) commit() {
+	for _, gauge := range s.gauges {
+		gauge.Commit()
+	}
+	s.last = time.Now()
+}
+
+// round indica qué grupos de métricas se recopilan en un Scan
+type round struct {
+	bloat       bool
+	pgstattuple bool
+	// presupuesto de tiempo restante para las métricas de pgstattuple,
+	// compartido por todas las bases de datos del Scan
+	budget *time.Duration
 }
 
 const (
 	dbSizeGauge = iota
+	dbFrozenXIDAgeGauge
+	dbMinMXIDAgeGauge
+	dbGrowthGauge
+	dbForecastGauge
+	tablespaceSizeGauge
+	tablespaceGrowthGauge
+	tablespaceForecastGauge
+	replicationSlotRetainedWALGauge
+	replicationSlotActiveGauge
+	replicationSlotSafeWALGauge
+	walDirSizeGauge
+	walDirFilesGauge
+	archiverArchivedGauge
+	archiverFailedGauge
+	archiverLastFailedGauge
+	archiverLastArchivedAgeGauge
+	statIOReadsCounter
+	statIOWritesCounter
+	statIOExtendsCounter
+	statIOHitsCounter
+	statIOEvictionsCounter
+	statIOFsyncsCounter
+	schemaSizeGauge
+	otherTablesSizeGauge
 	tableTotalSizeGauge
+	tableGrowthGauge
+	tableAnomalyGauge
 	tableRelSizeGauge
 	tableIdxSizeGauge
+	tableToastSizeGauge
+	tableRowsEstimateGauge
+	tableLiveTuplesGauge
+	tableDeadTuplesGauge
+	tableModSinceAnalyzeGauge
+	tableFrozenXIDAgeGauge
+	tableFrozenXIDPercentGauge
+	tableLastVacuumGauge
+	tableLastAutovacuumGauge
+	tableLastAnalyzeGauge
+	tableLastAutoanalyzeGauge
+	tableVacuumCountGauge
+	tableAutovacuumCountGauge
+	tableHeapBlksReadCounter
+	tableHeapBlksHitCounter
+	tableIdxBlksReadCounter
+	tableIdxBlksHitCounter
+	tableToastBlksReadCounter
+	tableToastBlksHitCounter
+	tableHeapBlksReadGauge
+	tableHeapBlksHitGauge
+	tableIdxBlksReadGauge
+	tableIdxBlksHitGauge
+	tableToastBlksReadGauge
+	tableToastBlksHitGauge
+	tableSeqScanCounter
+	tableSeqTupReadCounter
+	tableIdxScanCounter
+	tableIdxTupFetchCounter
+	tableTupInsCounter
+	tableTupUpdCounter
+	tableTupDelCounter
+	tableTupHotUpdCounter
+	tableSeqScanGauge
+	tableSeqTupReadGauge
+	tableIdxScanGauge
+	tableIdxTupFetchGauge
+	tableTupInsGauge
+	tableTupUpdGauge
+	tableTupDelGauge
+	tableTupHotUpdGauge
+	tableTablespaceSizeGauge
 	tableIsHypertableGauge
+	tablePartitionSizeGauge
+	indexSizeGauge
+	indexUnusedSizeGauge
+	indexRedundantSizeGauge
+	indexInvalidSizeGauge
+	foreignKeyUnindexedGauge
+	sequenceUsageRatioGauge
+	htBeforeCompressionGauge
+	htAfterCompressionGauge
+	htCompressionRatioGauge
+	htChunksGauge
+	htChunkIntervalGauge
+	htChunkRangeStartGauge
+	htChunkRangeEndGauge
+	htPolicyPendingChunksGauge
+	tsJobLastRunStatusGauge
+	tsJobLastSuccessGauge
+	tsJobNextStartGauge
+	tsJobFailuresGauge
+	caggWatermarkLagGauge
 	// total number of metrics
 	numMetrics
 )
 
+const (
+	tableSizeHistogram = iota
+	// total number of histograms
+	numHistograms
+)
+
+const (
+	tableBloatBytesGauge = iota
+	tableBloatRatioGauge
+	indexBloatBytesGauge
+	// total number of bloat metrics
+	numBloatMetrics
+)
+
+const (
+	pgstattupleFreeSpaceGauge = iota
+	pgstattupleDeadTupleLenGauge
+	pgstattupleTuplePercentGauge
+	// total number of pgstattuple metrics
+	numPgstattupleMetrics
+)
+
 func New(registerer prometheus.Registerer, prefix string) (Metrics, error) {
 	m := Metrics{
 		// Debe respetar el mismo orden que las constantes!
 		gauges: []*metrics.GaugeBatch{
 			metrics.NewGaugeBatch(prefix+"database_size", "Database size in bytes", []string{"database"}),
+			metrics.NewGaugeBatch(prefix+"database_frozenxid_age", "Age of the database frozen transaction ID", []string{"database"}),
+			metrics.NewGaugeBatch(prefix+"database_minmxid_age", "Age of the database minimum multixact ID", []string{"database"}),
+			metrics.NewGaugeBatch(prefix+"database_size_growth_bytes_per_second", "Database size growth rate in bytes per second", []string{"database"}),
+			metrics.NewGaugeBatch(prefix+"database_full_forecast_days", "Days until the database reaches its configured capacity", []string{"database"}),
+			metrics.NewGaugeBatch(prefix+"tablespace_size", "Tablespace size in bytes", []string{"tablespace", "location"}),
+			metrics.NewGaugeBatch(prefix+"tablespace_size_growth_bytes_per_second", "Tablespace size growth rate in bytes per second", []string{"tablespace", "location"}),
+			metrics.NewGaugeBatch(prefix+"tablespace_full_forecast_days", "Days until the tablespace reaches its configured capacity", []string{"tablespace", "location"}),
+			metrics.NewGaugeBatch(prefix+"replication_slot_retained_wal", "WAL bytes retained by the replication slot", []string{"slot_name", "slot_type", "database"}),
+			metrics.NewGaugeBatch(prefix+"replication_slot_active", "Replication slot is active", []string{"slot_name", "slot_type", "database"}),
+			metrics.NewGaugeBatch(prefix+"replication_slot_safe_wal_size", "WAL bytes that can be written before the slot is in danger of losing required WAL", []string{"slot_name", "slot_type", "database"}),
+			metrics.NewGaugeBatch(prefix+"wal_directory_size", "Total size in bytes of the WAL directory", []string{}),
+			metrics.NewGaugeBatch(prefix+"wal_directory_files", "Number of files in the WAL directory", []string{}),
+			metrics.NewGaugeBatch(prefix+"archiver_archived_count", "Number of WAL files successfully archived", []string{}),
+			metrics.NewGaugeBatch(prefix+"archiver_failed_count", "Number of failed attempts to archive WAL files", []string{}),
+			metrics.NewGaugeBatch(prefix+"archiver_last_failed_time", "Timestamp of the last failed archival operation", []string{}),
+			metrics.NewGaugeBatch(prefix+"archiver_last_archived_age", "Seconds since the last successful archival operation", []string{}),
+			metrics.NewCounterBatch(prefix+"stat_io_reads_total", "Number of read operations", []string{"backend_type", "object", "context"}),
+			metrics.NewCounterBatch(prefix+"stat_io_writes_total", "Number of write operations", []string{"backend_type", "object", "context"}),
+			metrics.NewCounterBatch(prefix+"stat_io_extends_total", "Number of relation extend operations", []string{"backend_type", "object", "context"}),
+			metrics.NewCounterBatch(prefix+"stat_io_hits_total", "Number of times a desired block was found in a shared buffer", []string{"backend_type", "object", "context"}),
+			metrics.NewCounterBatch(prefix+"stat_io_evictions_total", "Number of times a block has been written out from a buffer to make it available for another use", []string{"backend_type", "object", "context"}),
+			metrics.NewCounterBatch(prefix+"stat_io_fsyncs_total", "Number of fsync calls", []string{"backend_type", "object", "context"}),
+			metrics.NewGaugeBatch(prefix+"schema_size", "Total size in bytes of all tables in the schema", []string{"database", "schema", "kind"}),
+			metrics.NewGaugeBatch(prefix+"other_tables_size", "Total size in bytes of the tables below the threshold", []string{"database"}),
 			metrics.NewGaugeBatch(prefix+"table_size", "Total table size in bytes", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_size_growth_bytes_per_second", "Total table size growth rate in bytes per second", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_size_anomaly", "Table size grew abnormally since the previous scan", []string{"database", "schema", "name", "kind"}),
 			metrics.NewGaugeBatch(prefix+"table_relation_size", "Relation table size in bytes", []string{"database", "schema", "name", "kind"}),
 			metrics.NewGaugeBatch(prefix+"table_index_size", "Index table size in bytes", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_toast_size", "TOAST table size in bytes", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_rows_estimate", "Estimated number of rows", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_live_tuples", "Estimated number of live tuples", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_dead_tuples", "Estimated number of dead tuples", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_modifications_since_analyze", "Estimated number of rows modified since last analyze", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_frozenxid_age", "Age of the table frozen transaction ID", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_frozenxid_age_percent", "Age of the table frozen transaction ID as a percentage of autovacuum_freeze_max_age", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_last_vacuum", "Timestamp of the last manual vacuum", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_last_autovacuum", "Timestamp of the last autovacuum", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_last_analyze", "Timestamp of the last manual analyze", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_last_autoanalyze", "Timestamp of the last autoanalyze", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_vacuum_count", "Number of manual vacuums", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_autovacuum_count", "Number of autovacuums", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_heap_blks_read_total", "Number of disk blocks read from the table", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_heap_blks_hit_total", "Number of buffer hits in the table", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_idx_blks_read_total", "Number of disk blocks read from all indexes on the table", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_idx_blks_hit_total", "Number of buffer hits in all indexes on the table", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_toast_blks_read_total", "Number of disk blocks read from the TOAST table and its index", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_toast_blks_hit_total", "Number of buffer hits in the TOAST table and its index", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_heap_blks_read", "Number of disk blocks read from the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_heap_blks_hit", "Number of buffer hits in the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_idx_blks_read", "Number of disk blocks read from all indexes on the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_idx_blks_hit", "Number of buffer hits in all indexes on the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_toast_blks_read", "Number of disk blocks read from the TOAST tables of the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_toast_blks_hit", "Number of buffer hits in the TOAST tables of the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_seq_scan_total", "Number of sequential scans", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_seq_tup_read_total", "Number of live rows fetched by sequential scans", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_idx_scan_total", "Number of index scans", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_idx_tup_fetch_total", "Number of live rows fetched by index scans", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_tup_ins_total", "Number of rows inserted", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_tup_upd_total", "Number of rows updated", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_tup_del_total", "Number of rows deleted", []string{"database", "schema", "name", "kind"}),
+			metrics.NewCounterBatch(prefix+"table_tup_hot_upd_total", "Number of rows HOT updated", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_seq_scan", "Number of sequential scans on the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_seq_tup_read", "Number of live rows fetched by sequential scans on the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_idx_scan", "Number of index scans on the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_idx_tup_fetch", "Number of live rows fetched by index scans on the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_tup_ins", "Number of rows inserted in the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_tup_upd", "Number of rows updated in the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_tup_del", "Number of rows deleted from the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_tup_hot_upd", "Number of rows HOT updated in the current chunks or partitions", []string{"database", "schema", "name", "kind"}),
+			metrics.NewGaugeBatch(prefix+"table_tablespace_size", "Total table size in bytes stored in each tablespace", []string{"database", "schema", "name", "kind", "tablespace"}),
 			metrics.NewGaugeBatch(prefix+"table_is_hypertable", "Is hypertable", []string{"database", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"table_partition_size", "Total partition size in bytes", []string{"database", "schema", "name", "partition_schema", "partition"}),
+			metrics.NewGaugeBatch(prefix+"index_size", "Index size in bytes", []string{"database", "schema", "table", "index", "method", "is_unique", "is_primary"}),
+			metrics.NewGaugeBatch(prefix+"index_unused_size", "Size in bytes of indexes not scanned since the last statistics reset", []string{"database", "schema", "name", "kind", "index"}),
+			metrics.NewGaugeBatch(prefix+"index_redundant_size", "Size in bytes of indexes covered by another index", []string{"database", "schema", "name", "kind", "index", "covered_by"}),
+			metrics.NewGaugeBatch(prefix+"index_invalid_size", "Size in bytes of invalid indexes", []string{"database", "schema", "name", "kind", "index"}),
+			metrics.NewGaugeBatch(prefix+"foreign_key_unindexed_table_size", "Size in bytes of tables with a foreign key not supported by an index", []string{"database", "schema", "name", "kind", "constraint"}),
+			metrics.NewGaugeBatch(prefix+"sequence_usage_ratio", "Ratio of the sequence last value to its maximum value or the limit of the owning column type", []string{"database", "schema", "sequence", "table", "column"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_before_compression_size", "Size of compressed chunks before compression in bytes", []string{"database", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_after_compression_size", "Size of compressed chunks after compression in bytes", []string{"database", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_compression_ratio", "Compression ratio of compressed chunks", []string{"database", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_chunks", "Number of chunks", []string{"database", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_chunk_interval", "Chunk interval of the primary dimension", []string{"database", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_chunk_range_start", "Range start of the oldest and newest chunks", []string{"database", "schema", "name", "chunk"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_chunk_range_end", "Range end of the oldest and newest chunks", []string{"database", "schema", "name", "chunk"}),
+			metrics.NewGaugeBatch(prefix+"hypertable_policy_pending_chunks", "Number of chunks past the policy threshold not yet processed", []string{"database", "schema", "name", "policy"}),
+			metrics.NewGaugeBatch(prefix+"timescale_job_last_run_status", "Status of the last run of the job", []string{"database", "job_id", "application_name", "proc_name", "schema", "name", "status"}),
+			metrics.NewGaugeBatch(prefix+"timescale_job_last_success", "Timestamp of the last successful run of the job", []string{"database", "job_id", "application_name", "proc_name", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"timescale_job_next_start", "Timestamp of the next scheduled run of the job", []string{"database", "job_id", "application_name", "proc_name", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"timescale_job_failures", "Total number of failed runs of the job", []string{"database", "job_id", "application_name", "proc_name", "schema", "name"}),
+			metrics.NewGaugeBatch(prefix+"cagg_watermark_lag", "Seconds since the continuous aggregate watermark", []string{"database", "schema", "name"}),
+		},
+		// Debe respetar el mismo orden que las constantes!
+		histograms: []*metrics.HistogramBatch{
+			metrics.NewHistogramBatch(prefix+"table_size_distribution", "Distribution of table sizes in bytes", []string{"database"}, prometheus.ExponentialBuckets(units.MB, 10, 7)),
+		},
+		bloat: &schedule{
+			// Debe respetar el mismo orden que las constantes!
+			gauges: []*metrics.GaugeBatch{
+				metrics.NewGaugeBatch(prefix+"table_bloat_bytes", "Estimated table bloat in bytes", []string{"database", "schema", "name"}),
+				metrics.NewGaugeBatch(prefix+"table_bloat_ratio", "Estimated ratio of table bloat", []string{"database", "schema", "name"}),
+				metrics.NewGaugeBatch(prefix+"index_bloat_bytes", "Estimated btree index bloat in bytes", []string{"database", "schema", "table", "index"}),
+			},
+		},
+		growth: newGrowth(),
+		pgstattuple: &schedule{
+			// Debe respetar el mismo orden que las constantes!
+			gauges: []*metrics.GaugeBatch{
+				metrics.NewGaugeBatch(prefix+"pgstattuple_free_space", "Free space in bytes measured by pgstattuple", []string{"database", "schema", "name"}),
+				metrics.NewGaugeBatch(prefix+"pgstattuple_dead_tuple_len", "Total length of dead tuples in bytes measured by pgstattuple", []string{"database", "schema", "name"}),
+				metrics.NewGaugeBatch(prefix+"pgstattuple_tuple_percent", "Percentage of space used by live tuples measured by pgstattuple", []string{"database", "schema", "name"}),
+			},
 		},
 	}
-	gaugeErr := make([]error, 0, numMetrics)
+	gaugeErr := make([]error, 0, numMetrics+numHistograms+numBloatMetrics+numPgstattupleMetrics)
 	for _, gauge := range m.gauges {
 		gaugeErr = append(gaugeErr, registerer.Register(gauge))
 	}
+	for _, histogram := range m.histograms {
+		gaugeErr = append(gaugeErr, registerer.Register(histogram))
+	}
+	for _, gauge := range m.bloat.gauges {
+		gaugeErr = append(gaugeErr, registerer.Register(gauge))
+	}
+	for _, gauge := range m.pgstattuple.gauges {
+		gaugeErr = append(gaugeErr, registerer.Register(gauge))
+	}
 	return m, errors.Join(gaugeErr...)
 }
 
@@ -60,8 +339,8 @@ func New(registerer prometheus.Registerer, prefix string) (Metrics, error) {
 type scannerFunc func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error
 
 // doQuery ejecuta una query y envía todas las filas al scanner
-func doQuery(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, query string, scanner scannerFunc) error {
-	rows, err := conn.Query(ctx, query)
+func doQuery(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, query string, scanner scannerFunc, args ...any) error {
+	rows, err := conn.Query(ctx, query, args...)
 	if err != nil {
 		logger.Error(err.Error(), "op", "query", "query", query)
 		return err
@@ -74,25 +353,36 @@ func doQuery(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, query str
 			return err
 		}
 	}
-	if rows.Err() != nil {
+	if err := rows.Err(); err != nil {
 		logger.Error(err.Error(), "op", "error")
-		return rows.Err()
+		return err
 	}
 	return nil
 }
 
 // db recopila métricas globales de las bases de datos
-func (m Metrics) db(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) ([]string, error) {
-	query := "SELECT datname, pg_database_size(datname) FROM pg_database WHERE datallowconn = true AND datistemplate = false"
+func (m Metrics) db(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, cfg Config) ([]string, error) {
+	query := "SELECT datname, pg_database_size(datname), age(datfrozenxid), mxid_age(datminmxid) FROM pg_database WHERE datallowconn = true AND datistemplate = false"
 	dbnames := make([]string, 0, 16)
 	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
 		var database string
 		var value int64
-		if err := rows.Scan(&database, &value); err != nil {
+		var xidAge, mxidAge int64
+		if err := rows.Scan(&database, &value, &xidAge, &mxidAge); err != nil {
 			return err
 		}
 		logger.Debug("Scanned database size", "database", database, "size", value)
 		m.gauges[dbSizeGauge].Set([]string{database}, float64(value))
+		if rate, ok := m.growth.observe([]string{"database", database}, time.Now(), float64(value)); ok {
+			m.gauges[dbGrowthGauge].Set([]string{database}, rate)
+			if capacity, found := cfg.Capacity[database]; found {
+				if days, ok := forecastDays(float64(value), float64(capacity), rate); ok {
+					m.gauges[dbForecastGauge].Set([]string{database}, days)
+				}
+			}
+		}
+		m.gauges[dbFrozenXIDAgeGauge].Set([]string{database}, float64(xidAge))
+		m.gauges[dbMinMXIDAgeGauge].Set([]string{database}, float64(mxidAge))
 		dbnames = append(dbnames, database)
 		return nil
 	}
@@ -102,6 +392,44 @@ func (m Metrics) db(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) ([
 	return dbnames, nil
 }
 
+// tablespaceSize recopila el tamaño de cada tablespace
+//
+// pg_tablespace_size requiere privilegio CREATE sobre el tablespace, o el
+// rol pg_read_all_stats (salvo para el tablespace por defecto de la base
+// de datos), así que se omiten los tablespaces sin permiso, y se recopila
+// aparte de db para que un error no impida escanear las bases de datos.
+func (m Metrics) tablespaceSize(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, cfg Config) error {
+	query := `
+	SELECT spcname, pg_tablespace_location(oid), pg_tablespace_size(oid)
+	FROM pg_tablespace
+	WHERE has_tablespace_privilege(oid, 'CREATE')
+	OR pg_has_role('pg_read_all_stats', 'MEMBER')
+	OR oid = (SELECT dattablespace FROM pg_database WHERE datname = current_database())
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var tablespace, location string
+		var value int64
+		if err := rows.Scan(&tablespace, &location, &value); err != nil {
+			return err
+		}
+		logger.Debug("Scanned tablespace size", "tablespace", tablespace, "size", value)
+		m.gauges[tablespaceSizeGauge].Set([]string{tablespace, location}, float64(value))
+		if rate, ok := m.growth.observe([]string{"tablespace", tablespace}, time.Now(), float64(value)); ok {
+			m.gauges[tablespaceGrowthGauge].Set([]string{tablespace, location}, rate)
+			if capacity, found := cfg.TablespaceCapacity[tablespace]; found {
+				if days, ok := forecastDays(float64(value), float64(capacity), rate); ok {
+					m.gauges[tablespaceForecastGauge].Set([]string{tablespace, location}, days)
+				}
+			}
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
 // hasTimescale finds out if a database has timescale extension
 func hasTimescale(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) (bool, error) {
 	extVersion := ""
@@ -120,61 +448,384 @@ func hasTimescale(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) (boo
 	return true, nil
 }
 
-// table recopila métricas individuales de las tablas
-func (m Metrics) table(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, threshold int64) error {
-	var query string
-	ts, err := hasTimescale(ctx, logger, conn)
-	if err != nil {
-		return err
-	}
+// relationsQuery genera una CTE `relations` que asocia cada relación
+// con el esquema, nombre y tipo (kind) bajo el que se agrupan sus métricas.
+//
+// Las relaciones se enumeran desde pg_class y no desde
+// information_schema.tables, que solo incluye aquellas sobre las que
+// el usuario tiene privilegios y omite las vistas materializadas.
+func relationsQuery(ts bool) string {
+	hypertables := `
+		SELECT NULL::oid AS oid, NULL::name AS schema, NULL::name AS name, NULL::text AS kind
+		WHERE false
+	`
 	if ts {
-		query = `
-		SELECT
-			CASE WHEN t2.hypertable_name IS NULL THEN 0 ELSE 1 END as is_hypertable,
-			coalesce(t2.hypertable_schema, t1.table_schema) AS table_schema,
-			coalesce(t2.hypertable_name, t1.table_name) as table_name,
-			SUM(pg_total_relation_size(concat(quote_ident(t1.table_schema), '.', quote_ident(t1.table_name)))) as total_size,
-			SUM(pg_relation_size(concat(quote_ident(t1.table_schema), '.', quote_ident(t1.table_name)))) as relation_size
-		FROM information_schema.tables t1
-		LEFT JOIN timescaledb_information.chunks t2
-		ON t1.table_name=t2.chunk_name AND t1.table_schema=t2.chunk_schema
-		GROUP BY 1, 2, 3
-		`
-	} else {
-		query = `
+		hypertables = timescaleRelations
+	}
+	// Las particiones (a cualquier nivel de profundidad) se agrupan
+	// bajo la tabla particionada raíz.
+	return `
+	WITH RECURSIVE hypertables AS (` + hypertables + `),
+	partitions AS (
+		SELECT c.oid, n.nspname AS schema, c.relname AS name
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'p' AND NOT c.relispartition
+		UNION ALL
+		SELECT i.inhrelid AS oid, p.schema, p.name
+		FROM partitions p
+		JOIN pg_inherits i ON i.inhparent = p.oid
+	),
+	relations AS (
 		SELECT
-			0 AS is_hypertable,
-			t1.table_schema AS table_schema,
-			t1.table_name as table_name,
-			SUM(pg_total_relation_size(concat(quote_ident(t1.table_schema), '.', quote_ident(t1.table_name)))) as total_size,
-			SUM(pg_relation_size(concat(quote_ident(t1.table_schema), '.', quote_ident(t1.table_name)))) as relation_size
-		FROM information_schema.tables t1
-		GROUP BY 1, 2, 3
-		`
+			c.oid,
+			coalesce(h.schema, p.schema, n.nspname) AS schema,
+			coalesce(h.name, p.name, c.relname) AS name,
+			CASE
+				WHEN h.oid IS NOT NULL THEN h.kind
+				WHEN p.oid IS NOT NULL THEN 'part'
+				ELSE CASE c.relkind
+					WHEN 'r' THEN 'rel'
+					WHEN 'm' THEN 'matview'
+					WHEN 'f' THEN 'foreign'
+					WHEN 't' THEN 'toast'
+				END
+			END AS kind
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN hypertables h ON h.oid = c.oid
+		LEFT JOIN partitions p ON p.oid = c.oid
+		WHERE c.relkind IN ('r', 'm', 'p', 'f', 't')
+	)
+	`
+}
+
+// tableKey identifica una tabla (o grupo de relaciones)
+type tableKey struct {
+	schema string
+	name   string
+	kind   string
+}
+
+// tableRow contiene las métricas de una tabla (o grupo de relaciones)
+type tableRow struct {
+	tableKey
+	totalSize       int64
+	relSize         int64
+	idxSize         int64
+	toastSize       int64
+	rowsEstimate    float64
+	liveTuples      int64
+	deadTuples      int64
+	modified        int64
+	xidAge          int64
+	xidMaxAge       float64
+	lastVacuum      *float64
+	lastAutovacuum  *float64
+	lastAnalyze     *float64
+	lastAutoanalyze *float64
+	vacuumCount     int64
+	autovacuumCount int64
+	heapBlksRead    int64
+	heapBlksHit     int64
+	idxBlksRead     int64
+	idxBlksHit      int64
+	toastBlksRead   int64
+	toastBlksHit    int64
+	seqScan         int64
+	seqTupRead      int64
+	idxScan         int64
+	idxTupFetch     int64
+	tupIns          int64
+	tupUpd          int64
+	tupDel          int64
+	tupHotUpd       int64
+}
+
+// selectTables elige las tablas que superan el umbral de tamaño, o que
+// están entre las `top` más grandes de la base de datos (o de su esquema,
+// si perSchema). Las tablas TOAST no cuentan para el top, porque su
+// tamaño ya se incluye en el de la tabla a la que pertenecen.
+func selectTables(tables []tableRow, threshold int64, top int, perSchema bool) (selected []tableRow, dropped []tableRow) {
+	sorted := slices.Clone(tables)
+	slices.SortFunc(sorted, func(a, b tableRow) int {
+		return cmp.Compare(b.totalSize, a.totalSize)
+	})
+	rank := make(map[string]int)
+	for _, table := range sorted {
+		inTop := false
+		if top > 0 && table.kind != "toast" {
+			group := ""
+			if perSchema {
+				group = table.schema
+			}
+			inTop = rank[group] < top
+			rank[group]++
+		}
+		if inTop || table.totalSize >= threshold {
+			selected = append(selected, table)
+		} else {
+			dropped = append(dropped, table)
+		}
+	}
+	return selected, dropped
+}
+
+// tableSet devuelve el conjunto de tablas seleccionadas, para limitar
+// el resto de métricas por tabla a las mismas que table
+func tableSet(tables []tableRow) map[tableKey]bool {
+	selected := make(map[tableKey]bool, len(tables))
+	for _, table := range tables {
+		selected[table.tableKey] = true
+	}
+	return selected
+}
+
+// table recopila métricas individuales de las tablas, y devuelve
+// las tablas seleccionadas por selectTables.
+func (m Metrics) table(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, cfg Config, ts bool) ([]tableRow, error) {
+	// El tamaño de una tabla se descompone en relación (incluyendo los forks
+	// fsm y vm), índices y TOAST (incluyendo su propio índice), de forma que
+	// las tres partes sumen el tamaño total.
+	query := relationsQuery(ts) + `
+	SELECT
+		r.schema,
+		r.name,
+		r.kind,
+		SUM(pg_total_relation_size(c.oid)) AS total_size,
+		SUM(pg_table_size(c.oid) - t.toast_size) AS relation_size,
+		SUM(pg_indexes_size(c.oid)) AS index_size,
+		SUM(t.toast_size) AS toast_size,
+		SUM(greatest(c.reltuples, 0))::float8 AS rows_estimate,
+		coalesce(SUM(s.n_live_tup), 0) AS live_tuples,
+		coalesce(SUM(s.n_dead_tup), 0) AS dead_tuples,
+		coalesce(SUM(s.n_mod_since_analyze), 0) AS mod_since_analyze,
+		coalesce(MAX(CASE
+			WHEN c.relkind IN ('r', 'm', 't') THEN greatest(age(c.relfrozenxid), age(toast.relfrozenxid))
+		END), 0) AS frozenxid_age,
+		current_setting('autovacuum_freeze_max_age')::float8 AS freeze_max_age,
+		MAX(extract(epoch FROM s.last_vacuum))::float8 AS last_vacuum,
+		MAX(extract(epoch FROM s.last_autovacuum))::float8 AS last_autovacuum,
+		MAX(extract(epoch FROM s.last_analyze))::float8 AS last_analyze,
+		MAX(extract(epoch FROM s.last_autoanalyze))::float8 AS last_autoanalyze,
+		coalesce(SUM(s.vacuum_count), 0) AS vacuum_count,
+		coalesce(SUM(s.autovacuum_count), 0) AS autovacuum_count,
+		coalesce(SUM(io.heap_blks_read), 0) AS heap_blks_read,
+		coalesce(SUM(io.heap_blks_hit), 0) AS heap_blks_hit,
+		coalesce(SUM(io.idx_blks_read), 0) AS idx_blks_read,
+		coalesce(SUM(io.idx_blks_hit), 0) AS idx_blks_hit,
+		coalesce(SUM(io.toast_blks_read + io.tidx_blks_read), 0) AS toast_blks_read,
+		coalesce(SUM(io.toast_blks_hit + io.tidx_blks_hit), 0) AS toast_blks_hit,
+		coalesce(SUM(s.seq_scan), 0) AS seq_scan,
+		coalesce(SUM(s.seq_tup_read), 0) AS seq_tup_read,
+		coalesce(SUM(s.idx_scan), 0) AS idx_scan,
+		coalesce(SUM(s.idx_tup_fetch), 0) AS idx_tup_fetch,
+		coalesce(SUM(s.n_tup_ins), 0) AS tup_ins,
+		coalesce(SUM(s.n_tup_upd), 0) AS tup_upd,
+		coalesce(SUM(s.n_tup_del), 0) AS tup_del,
+		coalesce(SUM(s.n_tup_hot_upd), 0) AS tup_hot_upd
+	FROM relations r
+	JOIN pg_class c ON c.oid = r.oid
+	LEFT JOIN pg_class toast ON toast.oid = c.reltoastrelid
+	CROSS JOIN LATERAL (
+		SELECT CASE WHEN c.reltoastrelid = 0 THEN 0 ELSE pg_total_relation_size(c.reltoastrelid) END AS toast_size
+	) t
+	LEFT JOIN pg_stat_all_tables s ON s.relid = c.oid
+	LEFT JOIN pg_statio_all_tables io ON io.relid = c.oid
+	GROUP BY 1, 2, 3
+	`
+	tables := make([]tableRow, 0, 16)
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var t tableRow
+		if err := rows.Scan(&t.schema, &t.name, &t.kind, &t.totalSize, &t.relSize, &t.idxSize, &t.toastSize,
+			&t.rowsEstimate, &t.liveTuples, &t.deadTuples, &t.modified, &t.xidAge, &t.xidMaxAge,
+			&t.lastVacuum, &t.lastAutovacuum, &t.lastAnalyze, &t.lastAutoanalyze, &t.vacuumCount, &t.autovacuumCount,
+			&t.heapBlksRead, &t.heapBlksHit, &t.idxBlksRead, &t.idxBlksHit, &t.toastBlksRead, &t.toastBlksHit,
+			&t.seqScan, &t.seqTupRead, &t.idxScan, &t.idxTupFetch, &t.tupIns, &t.tupUpd, &t.tupDel, &t.tupHotUpd); err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return nil, err
 	}
+	selected, dropped := selectTables(tables, cfg.Threshold, cfg.Top, cfg.TopPerSchema)
+	for _, t := range selected {
+		m.setTable(database, t)
+		m.anomaly(logger, database, t, cfg)
+	}
+	// Tamaño agregado por esquema y tipo, y distribución de tamaños, de
+	// todas las relaciones, y tamaño de las que se descartan. Las tablas
+	// TOAST se omiten porque ya cuentan en el tamaño de la tabla a la
+	// que pertenecen.
+	schemaSize := make(map[tableKey]int64)
+	for _, t := range tables {
+		if t.kind != "toast" {
+			schemaSize[tableKey{schema: t.schema, kind: t.kind}] += t.totalSize
+			m.histograms[tableSizeHistogram].Observe([]string{database}, float64(t.totalSize))
+		}
+	}
+	for key, size := range schemaSize {
+		m.gauges[schemaSizeGauge].Set([]string{database, key.schema, key.kind}, float64(size))
+	}
+	otherSize := int64(0)
+	for _, t := range dropped {
+		if t.kind != "toast" {
+			otherSize += t.totalSize
+		}
+	}
+	m.gauges[otherTablesSizeGauge].Set([]string{database}, float64(otherSize))
+	return selected, nil
+}
+
+// setTable actualiza las métricas de una tabla
+func (m Metrics) setTable(database string, t tableRow) {
+	isHypertable := 0
+	if t.kind == "ht" {
+		isHypertable = 1
+	}
+	m.gauges[tableIsHypertableGauge].Set([]string{database, t.schema, t.name}, float64(isHypertable))
+	labels := []string{database, t.schema, t.name, t.kind}
+	m.gauges[tableTotalSizeGauge].Set(labels, float64(t.totalSize))
+	if rate, ok := m.growth.observe(append([]string{"table"}, labels...), time.Now(), float64(t.totalSize)); ok {
+		m.gauges[tableGrowthGauge].Set(labels, rate)
+	}
+	m.gauges[tableRelSizeGauge].Set(labels, float64(t.relSize))
+	m.gauges[tableIdxSizeGauge].Set(labels, float64(t.idxSize))
+	m.gauges[tableToastSizeGauge].Set(labels, float64(t.toastSize))
+	m.gauges[tableRowsEstimateGauge].Set(labels, t.rowsEstimate)
+	m.gauges[tableLiveTuplesGauge].Set(labels, float64(t.liveTuples))
+	m.gauges[tableDeadTuplesGauge].Set(labels, float64(t.deadTuples))
+	m.gauges[tableModSinceAnalyzeGauge].Set(labels, float64(t.modified))
+	m.gauges[tableFrozenXIDAgeGauge].Set(labels, float64(t.xidAge))
+	if t.xidMaxAge > 0 {
+		m.gauges[tableFrozenXIDPercentGauge].Set(labels, 100*float64(t.xidAge)/t.xidMaxAge)
+	}
+	// Las fechas son nulas si la tabla nunca se ha procesado
+	for gauge, timestamp := range map[int]*float64{
+		tableLastVacuumGauge:      t.lastVacuum,
+		tableLastAutovacuumGauge:  t.lastAutovacuum,
+		tableLastAnalyzeGauge:     t.lastAnalyze,
+		tableLastAutoanalyzeGauge: t.lastAutoanalyze,
+	} {
+		if timestamp != nil {
+			m.gauges[gauge].Set(labels, *timestamp)
+		}
+	}
+	m.gauges[tableVacuumCountGauge].Set(labels, float64(t.vacuumCount))
+	m.gauges[tableAutovacuumCountGauge].Set(labels, float64(t.autovacuumCount))
+	// Las hypertablas, tablas particionadas y agregados continuos suman las
+	// estadísticas de sus chunks o particiones actuales, que disminuyen al
+	// eliminar alguno. Para que Prometheus no lo confunda con un reinicio
+	// del contador, se publican como gauges.
+	aggregated := t.kind == "ht" || t.kind == "part" || t.kind == "cagg"
+	setStat := func(counter, gauge int, value int64) {
+		if aggregated {
+			m.gauges[gauge].Set(labels, float64(value))
+		} else {
+			m.gauges[counter].Set(labels, float64(value))
+		}
+	}
+	setStat(tableHeapBlksReadCounter, tableHeapBlksReadGauge, t.heapBlksRead)
+	setStat(tableHeapBlksHitCounter, tableHeapBlksHitGauge, t.heapBlksHit)
+	setStat(tableIdxBlksReadCounter, tableIdxBlksReadGauge, t.idxBlksRead)
+	setStat(tableIdxBlksHitCounter, tableIdxBlksHitGauge, t.idxBlksHit)
+	setStat(tableToastBlksReadCounter, tableToastBlksReadGauge, t.toastBlksRead)
+	setStat(tableToastBlksHitCounter, tableToastBlksHitGauge, t.toastBlksHit)
+	setStat(tableSeqScanCounter, tableSeqScanGauge, t.seqScan)
+	setStat(tableSeqTupReadCounter, tableSeqTupReadGauge, t.seqTupRead)
+	setStat(tableIdxScanCounter, tableIdxScanGauge, t.idxScan)
+	setStat(tableIdxTupFetchCounter, tableIdxTupFetchGauge, t.idxTupFetch)
+	setStat(tableTupInsCounter, tableTupInsGauge, t.tupIns)
+	setStat(tableTupUpdCounter, tableTupUpdGauge, t.tupUpd)
+	setStat(tableTupDelCounter, tableTupDelGauge, t.tupDel)
+	setStat(tableTupHotUpdCounter, tableTupHotUpdGauge, t.tupHotUpd)
+}
+
+// tablespace recopila el tamaño de cada tabla en cada tablespace
+//
+// Solo se informa de las tablas que ha devuelto table. Los índices se
+// atribuyen a su propio tablespace, que puede no ser el de la tabla.
+func (m Metrics) tablespace(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, tables []tableRow, ts bool) error {
+	query := relationsQuery(ts) + `,
+	parts AS (
+		SELECT r.schema, r.name, r.kind, c.reltablespace, pg_table_size(c.oid) AS size
+		FROM relations r
+		JOIN pg_class c ON c.oid = r.oid
+		UNION ALL
+		SELECT r.schema, r.name, r.kind, i.reltablespace, pg_table_size(i.oid) AS size
+		FROM relations r
+		JOIN pg_index x ON x.indrelid = r.oid
+		JOIN pg_class i ON i.oid = x.indexrelid
+	)
+	SELECT
+		p.schema,
+		p.name,
+		p.kind,
+		t.spcname,
+		SUM(p.size) AS size
+	FROM parts p
+	JOIN pg_tablespace t ON t.oid = CASE
+		WHEN p.reltablespace = 0 THEN (SELECT dattablespace FROM pg_database WHERE datname = current_database())
+		ELSE p.reltablespace
+	END
+	GROUP BY 1, 2, 3, 4
+	`
+	selected := tableSet(tables)
 	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
 		var (
-			isHypertable int
-			schema       string
-			name         string
-			tot_size     int64
-			rel_size     int64
+			schema     string
+			name       string
+			kind       string
+			tablespace string
+			size       int64
 		)
-		if err := rows.Scan(&isHypertable, &schema, &name, &tot_size, &rel_size); err != nil {
+		if err := rows.Scan(&schema, &name, &kind, &tablespace, &size); err != nil {
 			return err
 		}
-		if tot_size < threshold {
+		if !selected[tableKey{schema: schema, name: name, kind: kind}] {
 			return nil
 		}
-		kind := "rel"
-		if isHypertable > 0 {
-			kind = "ht"
+		m.gauges[tableTablespaceSizeGauge].Set([]string{database, schema, name, kind, tablespace}, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// partition recopila el tamaño individual de cada partición
+func (m Metrics) partition(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string, tables []tableRow, threshold int64, ts bool) error {
+	query := relationsQuery(ts) + `
+	SELECT
+		r.schema,
+		r.name,
+		n.nspname AS partition_schema,
+		c.relname AS partition_name,
+		pg_total_relation_size(c.oid) AS total_size
+	FROM relations r
+	JOIN pg_class c ON c.oid = r.oid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE r.kind = 'part' AND c.relkind <> 'p'
+	`
+	selected := tableSet(tables)
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema     string
+			name       string
+			partSchema string
+			partName   string
+			tot_size   int64
+		)
+		if err := rows.Scan(&schema, &name, &partSchema, &partName, &tot_size); err != nil {
+			return err
+		}
+		if tot_size < threshold || !selected[tableKey{schema: schema, name: name, kind: "part"}] {
+			return nil
 		}
-		m.gauges[tableIsHypertableGauge].Set([]string{database, schema, name}, float64(isHypertable))
-		labels := []string{database, schema, name, kind}
-		m.gauges[tableTotalSizeGauge].Set(labels, float64(tot_size))
-		m.gauges[tableRelSizeGauge].Set(labels, float64(rel_size))
-		m.gauges[tableIdxSizeGauge].Set(labels, float64(tot_size-rel_size))
+		m.gauges[tablePartitionSizeGauge].Set([]string{database, schema, name, partSchema, partName}, float64(tot_size))
 		return nil
 	}
 	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
@@ -192,18 +843,46 @@ type Factory interface {
 }
 
 type Config struct {
-	InitialDB  string        `json:"initialDb"`
-	Exceptions []string      `json:"exceptions"`
-	Threshold  int64         `json:"threshold"`
-	Pause      time.Duration `json:"pause"`
+	InitialDB           string           `json:"initialDb"`
+	Exceptions          []string         `json:"exceptions"`
+	Threshold           int64            `json:"threshold"`
+	Pause               time.Duration    `json:"pause"`
+	Partitions          bool             `json:"partitions"`
+	Top                 int              `json:"top"`
+	TopPerSchema        bool             `json:"topPerSchema"`
+	Bloat               bool             `json:"bloat"`
+	BloatInterval       time.Duration    `json:"bloatInterval"`
+	PgstattupleTop      int              `json:"pgstattupleTop"`
+	PgstattupleFull     bool             `json:"pgstattupleFull"`
+	PgstattupleInterval time.Duration    `json:"pgstattupleInterval"`
+	PgstattupleBudget   time.Duration    `json:"pgstattupleBudget"`
+	GrowthWindow        int              `json:"growthWindow"`
+	Capacity            map[string]int64 `json:"capacity"`
+	TablespaceCapacity  map[string]int64 `json:"tablespaceCapacity"`
+	AnomalyZScore       float64          `json:"anomalyZScore"`
+	AnomalyPercent      float64          `json:"anomalyPercent"`
 }
 
 func Defaults() Config {
 	return Config{
-		InitialDB:  "postgres",
-		Exceptions: []string{"template0", "template1", "postgres"},
-		Threshold:  0,
-		Pause:      0,
+		InitialDB:           "postgres",
+		Exceptions:          []string{"template0", "template1", "postgres"},
+		Threshold:           0,
+		Pause:               0,
+		Partitions:          false,
+		Top:                 0,
+		TopPerSchema:        false,
+		Bloat:               false,
+		BloatInterval:       24 * time.Hour,
+		PgstattupleTop:      0,
+		PgstattupleFull:     false,
+		PgstattupleInterval: 24 * time.Hour,
+		PgstattupleBudget:   10 * time.Minute,
+		GrowthWindow:        6,
+		Capacity:            map[string]int64{},
+		TablespaceCapacity:  map[string]int64{},
+		AnomalyZScore:       3,
+		AnomalyPercent:      0,
 	}
 }
 
@@ -215,6 +894,23 @@ func (m Metrics) Scan(ctx context.Context, logger *slog.Logger, cfg Config, fact
 	// Begin metrics collection, and cooit inconditionally
 	m.begin()
 	defer m.commit()
+	m.growth.begin(cfg.GrowthWindow)
+	defer m.growth.prune()
+	var r round
+	if cfg.Bloat && m.bloat.due(cfg.BloatInterval) {
+		logger.Info("Estimating bloat in this scan")
+		r.bloat = true
+		m.bloat.begin()
+	}
+	if cfg.PgstattupleTop > 0 && m.pgstattuple.due(cfg.PgstattupleInterval) {
+		logger.Info("Measuring tables with pgstattuple in this scan")
+		r.pgstattuple = true
+		budget := cfg.PgstattupleBudget
+		r.budget = &budget
+		m.pgstattuple.begin()
+	}
+	// Las métricas del servidor no impiden escanear las bases de datos
+	var serverErr error
 	// Wrap this inside a closure, for deferring
 	dbNames, err := func() ([]string, error) {
 		conn, err := factory.Connect(ctx, logger, cfg.InitialDB)
@@ -222,21 +918,41 @@ func (m Metrics) Scan(ctx context.Context, logger *slog.Logger, cfg Config, fact
 			return nil, err
 		}
 		defer factory.Dispose(ctx, logger, conn, cfg.InitialDB)
-		return m.db(ctx, logger, conn)
+		dbNames, err := m.db(ctx, logger, conn, cfg)
+		if err != nil {
+			return nil, err
+		}
+		serverErr = errors.Join(
+			m.tablespaceSize(ctx, logger, conn, cfg),
+			m.server(ctx, logger, conn),
+		)
+		if serverErr != nil {
+			logger.Error(serverErr.Error(), "op", "server_metrics")
+		}
+		return dbNames, nil
 	}()
 	if err != nil {
 		logger.Error(err.Error(), "op", "db_metrics")
 		return err
 	}
+	// Los grupos lentos solo se publican si se ha llegado a recorrer
+	// las bases de datos, para no perder los valores anteriores.
+	if r.bloat {
+		defer m.bloat.commit()
+	}
+	if r.pgstattuple {
+		defer m.pgstattuple.commit()
+	}
 	logger.Info("Databases found", "count", len(dbNames))
-	dbErrors := make([]error, 0, len(dbNames))
+	dbErrors := make([]error, 0, len(dbNames)+1)
+	dbErrors = append(dbErrors, serverErr)
 	for _, database := range dbNames {
-		dbErrors = append(dbErrors, m.scanDatabase(ctx, logger, cfg, factory, database))
+		dbErrors = append(dbErrors, m.scanDatabase(ctx, logger, cfg, factory, database, r))
 	}
 	return errors.Join(dbErrors...)
 }
 
-func (m Metrics) scanDatabase(ctx context.Context, logger *slog.Logger, cfg Config, factory Factory, database string) error {
+func (m Metrics) scanDatabase(ctx context.Context, logger *slog.Logger, cfg Config, factory Factory, database string, r round) error {
 	if cfg.Exceptions != nil {
 		for _, exc := range cfg.Exceptions {
 			match, err := filepath.Match(exc, database)
@@ -261,7 +977,38 @@ func (m Metrics) scanDatabase(ctx context.Context, logger *slog.Logger, cfg Conf
 			return err
 		}
 		defer factory.Dispose(ctx, dbLogger, conn, database)
-		return m.table(ctx, dbLogger, conn, database, cfg.Threshold)
+		ts, err := hasTimescale(ctx, dbLogger, conn)
+		if err != nil {
+			return err
+		}
+		tables, err := m.table(ctx, dbLogger, conn, database, cfg, ts)
+		dbErrors := []error{
+			err,
+			m.index(ctx, dbLogger, conn, database, tables, cfg.Threshold, ts),
+			m.indexHealth(ctx, dbLogger, conn, database, tables, cfg.Threshold, ts),
+			m.sequence(ctx, dbLogger, conn, database),
+			m.tablespace(ctx, dbLogger, conn, database, tables, ts),
+		}
+		if ts {
+			dbErrors = append(dbErrors,
+				m.compression(ctx, dbLogger, conn, database),
+				m.chunks(ctx, dbLogger, conn, database),
+				m.jobs(ctx, dbLogger, conn, database),
+				m.caggs(ctx, dbLogger, conn, database),
+			)
+		}
+		if r.bloat {
+			dbErrors = append(dbErrors, m.tableBloat(ctx, dbLogger, conn, database, cfg.Threshold), m.indexBloat(ctx, dbLogger, conn, database, cfg.Threshold))
+		}
+		if cfg.Partitions {
+			dbErrors = append(dbErrors, m.partition(ctx, dbLogger, conn, database, tables, cfg.Threshold, ts))
+		}
+		// pgstattuple se ejecuta al final, para que el statement_timeout
+		// que impone el presupuesto de tiempo no afecte al resto.
+		if r.pgstattuple {
+			dbErrors = append(dbErrors, m.tupleStats(ctx, dbLogger, conn, database, tables, cfg.PgstattupleTop, cfg.PgstattupleFull, r.budget))
+		}
+		return errors.Join(dbErrors...)
 	}()
 	if err != nil {
 		dbLogger.Error(err.Error(), "op", "table_metrics")
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// sequence recopila el grado de uso de cada secuencia, respecto a su
+// valor máximo o al límite del tipo de la columna a la que pertenece
+// (serial o identity), el que sea menor.
+func (m Metrics) sequence(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string) error {
+	query := `
+	WITH sequences AS (
+		SELECT
+			s.schemaname,
+			s.sequencename,
+			coalesce(t.relname::text, '') AS table_name,
+			coalesce(a.attname::text, '') AS column_name,
+			s.increment_by,
+			s.last_value::float8 AS last_value,
+			LEAST(s.max_value::float8, CASE a.atttypid
+				WHEN 'int2'::regtype::oid THEN 32767
+				WHEN 'int4'::regtype::oid THEN 2147483647
+				ELSE s.max_value::float8
+			END) AS max_value,
+			GREATEST(s.min_value::float8, CASE a.atttypid
+				WHEN 'int2'::regtype::oid THEN -32768
+				WHEN 'int4'::regtype::oid THEN -2147483648
+				ELSE s.min_value::float8
+			END) AS min_value
+		FROM pg_sequences s
+		JOIN pg_namespace n ON n.nspname = s.schemaname
+		JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequencename
+		LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass
+			AND d.objid = c.oid
+			AND d.refclassid = 'pg_class'::regclass
+			AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_class t ON t.oid = d.refobjid
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE s.last_value IS NOT NULL
+	)
+	SELECT
+		schemaname,
+		sequencename,
+		table_name,
+		column_name,
+		CASE WHEN increment_by > 0
+			THEN last_value / NULLIF(max_value, 0)
+			ELSE last_value / NULLIF(min_value, 0)
+		END AS usage_ratio
+	FROM sequences
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema string
+			name   string
+			table  string
+			column string
+			ratio  *float64
+		)
+		if err := rows.Scan(&schema, &name, &table, &column, &ratio); err != nil {
+			return err
+		}
+		if ratio == nil {
+			return nil
+		}
+		m.gauges[sequenceUsageRatioGauge].Set([]string{database, schema, name, table, column}, *ratio)
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
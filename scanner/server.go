@@ -0,0 +1,197 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// serverVersion devuelve la versión del servidor (server_version_num)
+func serverVersion(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) (int, error) {
+	version := 0
+	query := "SELECT current_setting('server_version_num')::int"
+	rscan := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		return rows.Scan(&version)
+	}
+	if err := doQuery(ctx, logger, conn, query, rscan); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// server recopila métricas globales del servidor, que no dependen
+// de la base de datos a la que se conecta.
+func (m Metrics) server(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) error {
+	version, err := serverVersion(ctx, logger, conn)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Server version", "version", version)
+	return errors.Join(
+		m.replication(ctx, logger, conn, version),
+		m.wal(ctx, logger, conn),
+		m.statIO(ctx, logger, conn, version),
+	)
+}
+
+// replication recopila el WAL retenido por los slots de replicación
+func (m Metrics) replication(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, version int) error {
+	// safe_wal_size existe a partir de PostgreSQL 13
+	safeWALSize := "NULL::bigint"
+	if version >= 130000 {
+		safeWALSize = "safe_wal_size"
+	}
+	query := `
+	SELECT
+		slot_name,
+		slot_type,
+		coalesce(database, '') AS database,
+		active,
+		pg_wal_lsn_diff(
+			CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END,
+			restart_lsn
+		)::float8 AS retained_wal,
+		` + safeWALSize + ` AS safe_wal_size
+	FROM pg_replication_slots
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			name        string
+			slotType    string
+			database    string
+			active      bool
+			retainedWAL *float64
+			safeWALSize *int64
+		)
+		if err := rows.Scan(&name, &slotType, &database, &active, &retainedWAL, &safeWALSize); err != nil {
+			return err
+		}
+		labels := []string{name, slotType, database}
+		isActive := 0
+		if active {
+			isActive = 1
+		}
+		m.gauges[replicationSlotActiveGauge].Set(labels, float64(isActive))
+		// restart_lsn es nulo si el slot nunca ha reservado WAL
+		if retainedWAL != nil {
+			m.gauges[replicationSlotRetainedWALGauge].Set(labels, *retainedWAL)
+		}
+		if safeWALSize != nil {
+			m.gauges[replicationSlotSafeWALGauge].Set(labels, float64(*safeWALSize))
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// wal recopila el tamaño del directorio pg_wal y el estado del archivador
+func (m Metrics) wal(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) error {
+	query := "SELECT count(*), coalesce(sum(size), 0) FROM pg_ls_waldir()"
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var files, size int64
+		if err := rows.Scan(&files, &size); err != nil {
+			return err
+		}
+		m.gauges[walDirFilesGauge].Set([]string{}, float64(files))
+		m.gauges[walDirSizeGauge].Set([]string{}, float64(size))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	query = `
+	SELECT
+		archived_count,
+		failed_count,
+		extract(epoch FROM last_failed_time)::float8 AS last_failed_time,
+		extract(epoch FROM now() - last_archived_time)::float8 AS last_archived_age
+	FROM pg_stat_archiver
+	`
+	scanner = func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			archived        int64
+			failed          int64
+			lastFailed      *float64
+			lastArchivedAge *float64
+		)
+		if err := rows.Scan(&archived, &failed, &lastFailed, &lastArchivedAge); err != nil {
+			return err
+		}
+		m.gauges[archiverArchivedGauge].Set([]string{}, float64(archived))
+		m.gauges[archiverFailedGauge].Set([]string{}, float64(failed))
+		// Las fechas son nulas si nunca se ha archivado (o fallado)
+		if lastFailed != nil {
+			m.gauges[archiverLastFailedGauge].Set([]string{}, *lastFailed)
+		}
+		if lastArchivedAge != nil {
+			m.gauges[archiverLastArchivedAgeGauge].Set([]string{}, *lastArchivedAge)
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// statIO recopila las estadísticas de E/S por tipo de proceso, objeto
+// y contexto (pg_stat_io, a partir de PostgreSQL 16)
+func (m Metrics) statIO(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, version int) error {
+	if version < 160000 {
+		return nil
+	}
+	query := `
+	SELECT
+		backend_type,
+		object,
+		context,
+		reads,
+		writes,
+		extends,
+		hits,
+		evictions,
+		fsyncs
+	FROM pg_stat_io
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			backendType string
+			object      string
+			ioContext   string
+			reads       *int64
+			writes      *int64
+			extends     *int64
+			hits        *int64
+			evictions   *int64
+			fsyncs      *int64
+		)
+		if err := rows.Scan(&backendType, &object, &ioContext, &reads, &writes, &extends, &hits, &evictions, &fsyncs); err != nil {
+			return err
+		}
+		// Las operaciones que no aplican a una combinación de
+		// proceso, objeto y contexto son nulas
+		labels := []string{backendType, object, ioContext}
+		for counter, value := range map[int]*int64{
+			statIOReadsCounter:     reads,
+			statIOWritesCounter:    writes,
+			statIOExtendsCounter:   extends,
+			statIOHitsCounter:      hits,
+			statIOEvictionsCounter: evictions,
+			statIOFsyncsCounter:    fsyncs,
+		} {
+			if value != nil {
+				m.gauges[counter].Set(labels, float64(*value))
+			}
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// timescaleRelations asocia cada relación que forma parte de una
+// hypertabla con el esquema y nombre de la hypertabla.
+//
+// Se usa el catálogo de TimescaleDB en lugar de timescaledb_information.chunks
+// para poder incluir la hypertabla interna que almacena los datos
+// comprimidos, y sus chunks, que de otra forma aparecerían como tablas
+// sueltas en `_timescaledb_internal`.
+//
+// Las hypertablas de materialización de los agregados continuos se
+// asocian con el esquema y nombre de la vista del agregado.
+const timescaleRelations = `
+		SELECT
+			c.oid,
+			coalesce(ca.view_schema, h.schema_name) AS schema,
+			coalesce(ca.view_name, h.table_name) AS name,
+			CASE WHEN ca.view_name IS NULL THEN 'ht' ELSE 'cagg' END AS kind
+		FROM _timescaledb_catalog.hypertable h
+		LEFT JOIN timescaledb_information.continuous_aggregates ca
+		ON ca.materialization_hypertable_schema = h.schema_name
+		AND ca.materialization_hypertable_name = h.table_name
+		CROSS JOIN LATERAL (
+			SELECT h.schema_name AS rel_schema, h.table_name AS rel_name
+			UNION ALL
+			SELECT z.schema_name, z.table_name
+			FROM _timescaledb_catalog.hypertable z
+			WHERE z.id = h.compressed_hypertable_id
+			UNION ALL
+			SELECT k.schema_name, k.table_name
+			FROM _timescaledb_catalog.chunk k
+			WHERE k.hypertable_id IN (h.id, h.compressed_hypertable_id) AND NOT k.dropped
+		) t
+		JOIN pg_namespace n ON n.nspname = t.rel_schema
+		JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = t.rel_name
+		WHERE NOT EXISTS (
+			SELECT 1 FROM _timescaledb_catalog.hypertable p
+			WHERE p.compressed_hypertable_id = h.id
+		)
+	`
+
+// timescaleIndexParents asocia el índice de cada chunk con el índice de
+// la hypertabla del que deriva, a partir de _timescaledb_catalog.chunk_index
+const timescaleIndexParents = `
+		SELECT ci.oid, hi.oid AS parent
+		FROM _timescaledb_catalog.chunk_index x
+		JOIN _timescaledb_catalog.chunk k ON k.id = x.chunk_id
+		JOIN _timescaledb_catalog.hypertable h ON h.id = x.hypertable_id
+		JOIN pg_namespace kn ON kn.nspname = k.schema_name
+		JOIN pg_class ci ON ci.relnamespace = kn.oid AND ci.relname = x.index_name
+		JOIN pg_namespace hn ON hn.nspname = h.schema_name
+		JOIN pg_class hi ON hi.relnamespace = hn.oid AND hi.relname = x.hypertable_index_name
+	`
+
+// hasChunkIndex comprueba si existe el catálogo chunk_index de TimescaleDB,
+// que no está disponible en todas las versiones
+func hasChunkIndex(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) (bool, error) {
+	found := false
+	query := "SELECT to_regclass('_timescaledb_catalog.chunk_index') IS NOT NULL"
+	rscan := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		return rows.Scan(&found)
+	}
+	if err := doQuery(ctx, logger, conn, query, rscan); err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// timescaleFunctions devuelve el esquema de las funciones internas de
+// TimescaleDB, que cambió de `_timescaledb_internal` a
+// `_timescaledb_functions` en la versión 2.12
+func timescaleFunctions(ctx context.Context, logger *slog.Logger, conn *pgx.Conn) (string, error) {
+	schema := ""
+	query := "SELECT coalesce(to_regnamespace('_timescaledb_functions')::text, '_timescaledb_internal')"
+	rscan := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		return rows.Scan(&schema)
+	}
+	if err := doQuery(ctx, logger, conn, query, rscan); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// compression recopila métricas de compresión de las hypertablas
+func (m Metrics) compression(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string) error {
+	query := `
+	SELECT
+		h.hypertable_schema,
+		h.hypertable_name,
+		coalesce(SUM(s.before_compression_total_bytes), 0) AS before_size,
+		coalesce(SUM(s.after_compression_total_bytes), 0) AS after_size
+	FROM timescaledb_information.hypertables h
+	CROSS JOIN LATERAL hypertable_compression_stats(format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass) s
+	WHERE h.compression_enabled
+	GROUP BY 1, 2
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema      string
+			name        string
+			before_size int64
+			after_size  int64
+		)
+		if err := rows.Scan(&schema, &name, &before_size, &after_size); err != nil {
+			return err
+		}
+		labels := []string{database, schema, name}
+		m.gauges[htBeforeCompressionGauge].Set(labels, float64(before_size))
+		m.gauges[htAfterCompressionGauge].Set(labels, float64(after_size))
+		if after_size > 0 {
+			m.gauges[htCompressionRatioGauge].Set(labels, float64(before_size)/float64(after_size))
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// chunks recopila el inventario de chunks de las hypertablas, y el número
+// de chunks que las políticas de compresión y retención deberían haber
+// procesado y no lo han hecho.
+//
+// Los rangos de las dimensiones temporales se expresan en segundos desde
+// epoch, y los de las dimensiones enteras en las unidades de la columna.
+func (m Metrics) chunks(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string) error {
+	query := `
+	SELECT
+		h.hypertable_schema,
+		h.hypertable_name,
+		count(c.chunk_name) AS chunks,
+		min(coalesce(extract(epoch FROM c.range_start), c.range_start_integer))::float8 AS oldest_start,
+		min(coalesce(extract(epoch FROM c.range_end), c.range_end_integer))::float8 AS oldest_end,
+		max(coalesce(extract(epoch FROM c.range_start), c.range_start_integer))::float8 AS newest_start,
+		max(coalesce(extract(epoch FROM c.range_end), c.range_end_integer))::float8 AS newest_end,
+		max(coalesce(extract(epoch FROM d.time_interval), d.integer_interval))::float8 AS chunk_interval
+	FROM timescaledb_information.hypertables h
+	LEFT JOIN timescaledb_information.chunks c
+	ON c.hypertable_schema = h.hypertable_schema AND c.hypertable_name = h.hypertable_name
+	LEFT JOIN timescaledb_information.dimensions d
+	ON d.hypertable_schema = h.hypertable_schema AND d.hypertable_name = h.hypertable_name AND d.dimension_number = 1
+	GROUP BY 1, 2
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema        string
+			name          string
+			chunks        int64
+			oldestStart   *float64
+			oldestEnd     *float64
+			newestStart   *float64
+			newestEnd     *float64
+			chunkInterval *float64
+		)
+		if err := rows.Scan(&schema, &name, &chunks, &oldestStart, &oldestEnd, &newestStart, &newestEnd, &chunkInterval); err != nil {
+			return err
+		}
+		labels := []string{database, schema, name}
+		m.gauges[htChunksGauge].Set(labels, float64(chunks))
+		if chunkInterval != nil {
+			m.gauges[htChunkIntervalGauge].Set(labels, *chunkInterval)
+		}
+		ranges := []struct {
+			chunk string
+			start *float64
+			end   *float64
+		}{
+			{chunk: "oldest", start: oldestStart, end: oldestEnd},
+			{chunk: "newest", start: newestStart, end: newestEnd},
+		}
+		for _, r := range ranges {
+			rangeLabels := []string{database, schema, name, r.chunk}
+			if r.start != nil {
+				m.gauges[htChunkRangeStartGauge].Set(rangeLabels, *r.start)
+			}
+			if r.end != nil {
+				m.gauges[htChunkRangeEndGauge].Set(rangeLabels, *r.end)
+			}
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	// Solo se pueden verificar las políticas configuradas con un intervalo
+	// (dimensiones temporales). Las expresiones CASE garantizan que no se
+	// intenta convertir a interval una configuración entera.
+	query = `
+	SELECT
+		j.hypertable_schema,
+		j.hypertable_name,
+		CASE WHEN j.proc_name = 'policy_compression' THEN 'compression' ELSE 'retention' END AS policy,
+		count(c.chunk_name) AS pending
+	FROM timescaledb_information.jobs j
+	CROSS JOIN LATERAL (
+		SELECT CASE
+			WHEN j.proc_name = 'policy_compression' THEN j.config -> 'compress_after'
+			ELSE j.config -> 'drop_after'
+		END AS after
+	) a
+	LEFT JOIN timescaledb_information.chunks c
+	ON c.hypertable_schema = j.hypertable_schema
+	AND c.hypertable_name = j.hypertable_name
+	AND c.range_end < now() - CASE WHEN jsonb_typeof(a.after) = 'string' THEN (a.after #>> '{}')::interval END
+	AND (j.proc_name = 'policy_retention' OR NOT c.is_compressed)
+	WHERE j.proc_name IN ('policy_compression', 'policy_retention')
+	AND jsonb_typeof(a.after) = 'string'
+	GROUP BY 1, 2, 3
+	`
+	scanner = func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema  string
+			name    string
+			policy  string
+			pending int64
+		)
+		if err := rows.Scan(&schema, &name, &policy, &pending); err != nil {
+			return err
+		}
+		m.gauges[htPolicyPendingChunksGauge].Set([]string{database, schema, name, policy}, float64(pending))
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// jobs recopila el estado de los trabajos en segundo plano de TimescaleDB
+// (políticas de compresión, retención, refresco de agregados continuos...)
+func (m Metrics) jobs(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string) error {
+	query := `
+	SELECT
+		j.job_id,
+		j.application_name,
+		j.proc_name,
+		coalesce(j.hypertable_schema, '') AS hypertable_schema,
+		coalesce(j.hypertable_name, '') AS hypertable_name,
+		s.last_run_status,
+		extract(epoch FROM s.last_successful_finish)::float8 AS last_success,
+		extract(epoch FROM coalesce(s.next_start, j.next_start))::float8 AS next_start,
+		s.total_failures
+	FROM timescaledb_information.jobs j
+	LEFT JOIN timescaledb_information.job_stats s ON s.job_id = j.job_id
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			jobID         int64
+			application   string
+			procName      string
+			schema        string
+			name          string
+			lastStatus    *string
+			lastSuccess   *float64
+			nextStart     *float64
+			totalFailures *int64
+		)
+		if err := rows.Scan(&jobID, &application, &procName, &schema, &name, &lastStatus, &lastSuccess, &nextStart, &totalFailures); err != nil {
+			return err
+		}
+		labels := []string{database, strconv.FormatInt(jobID, 10), application, procName, schema, name}
+		if lastStatus != nil {
+			m.gauges[tsJobLastRunStatusGauge].Set(append(labels, *lastStatus), 1)
+		}
+		if lastSuccess != nil {
+			m.gauges[tsJobLastSuccessGauge].Set(labels, *lastSuccess)
+		}
+		if nextStart != nil {
+			m.gauges[tsJobNextStartGauge].Set(labels, *nextStart)
+		}
+		if totalFailures != nil {
+			m.gauges[tsJobFailuresGauge].Set(labels, float64(*totalFailures))
+		}
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}
+
+// caggs recopila el retraso de la marca de agua (watermark) de los
+// agregados continuos con dimensión temporal
+func (m Metrics) caggs(ctx context.Context, logger *slog.Logger, conn *pgx.Conn, database string) error {
+	fn, err := timescaleFunctions(ctx, logger, conn)
+	if err != nil {
+		return err
+	}
+	query := `
+	SELECT
+		ca.view_schema,
+		ca.view_name,
+		extract(epoch FROM now() - w.watermark)::float8 AS lag
+	FROM timescaledb_information.continuous_aggregates ca
+	JOIN _timescaledb_catalog.hypertable h
+	ON h.schema_name = ca.materialization_hypertable_schema
+	AND h.table_name = ca.materialization_hypertable_name
+	JOIN timescaledb_information.dimensions d
+	ON d.hypertable_schema = ca.materialization_hypertable_schema
+	AND d.hypertable_name = ca.materialization_hypertable_name
+	AND d.dimension_number = 1
+	CROSS JOIN LATERAL (
+		SELECT ` + fn + `.to_timestamp(` + fn + `.cagg_watermark(h.id)) AS watermark
+	) w
+	WHERE d.column_type IN ('timestamptz'::regtype, 'timestamp'::regtype, 'date'::regtype)
+	AND isfinite(w.watermark)
+	`
+	scanner := func(ctx context.Context, logger *slog.Logger, rows pgx.Rows) error {
+		var (
+			schema string
+			name   string
+			lag    float64
+		)
+		if err := rows.Scan(&schema, &name, &lag); err != nil {
+			return err
+		}
+		m.gauges[caggWatermarkLagGauge].Set([]string{database, schema, name}, lag)
+		return nil
+	}
+	if err := doQuery(ctx, logger, conn, query, scanner); err != nil {
+		return err
+	}
+	return nil
+}